@@ -0,0 +1,224 @@
+package pack
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	testEnvironment = "test"
+)
+
+// ImportAudit is the result of comparing the imports of a package against
+// the dependencies declared in its Pack.
+type ImportAudit struct {
+	// Undeclared are imports that match no declared dependency.
+	Undeclared []string `json:"undeclared"`
+	// Unused are declared dependencies that no file imports.
+	Unused []string `json:"unused"`
+	// TestOnly are dependencies imported only from _test.go files but
+	// declared outside of a test environment.
+	TestOnly []string `json:"testOnly"`
+}
+
+// AuditImports parses the go files in dir and in each of the Pack's
+// Subpackages and compares their imports against the Pack's Dependencies and
+// Environments. Standard library imports and imports of the package itself
+// are ignored.
+func AuditImports(dir string, p *Pack) (*ImportAudit, error) {
+	dirs := []string{dir}
+	for _, sub := range p.Subpackages {
+		dirs = append(dirs, filepath.Join(dir, filepath.FromSlash(sub)))
+	}
+
+	imports := make(map[string]bool)
+	testImports := make(map[string]bool)
+	for _, d := range dirs {
+		if err := collectImports(d, imports, testImports); err != nil {
+			return nil, err
+		}
+	}
+
+	type declaration struct {
+		dep    *Dependency
+		inTest bool
+		used   bool
+	}
+	var decls []*declaration
+	byName := make(map[string]*declaration)
+	declare := func(deps []*Dependency, test bool) {
+		for _, dep := range deps {
+			decl, ok := byName[dep.Name]
+			if !ok {
+				decl = &declaration{dep: dep}
+				byName[dep.Name] = decl
+				decls = append(decls, decl)
+			}
+			decl.inTest = decl.inTest || test
+		}
+	}
+	declare(p.Dependencies, false)
+	for env, deps := range p.Environments {
+		declare(deps, isTestEnvironment(env))
+	}
+
+	audit := &ImportAudit{
+		Undeclared: []string{},
+		Unused:     []string{},
+		TestOnly:   []string{},
+	}
+	testOnly := make(map[string]bool)
+	check := func(imp string, test bool) {
+		if isStandardImport(imp) || isSelfImport(p, imp) {
+			return
+		}
+		var match *declaration
+		for _, decl := range decls {
+			if !importMatches(decl.dep.Name, imp) {
+				continue
+			}
+			if match == nil || len(decl.dep.Name) > len(match.dep.Name) {
+				match = decl
+			}
+		}
+		if match == nil {
+			audit.Undeclared = append(audit.Undeclared, imp)
+			return
+		}
+		match.used = true
+		if test && !match.inTest {
+			testOnly[match.dep.Name] = true
+		}
+	}
+
+	for _, imp := range sortedKeys(imports) {
+		check(imp, false)
+	}
+	for _, imp := range sortedKeys(testImports) {
+		if !imports[imp] {
+			check(imp, true)
+		}
+	}
+
+	for _, decl := range decls {
+		if !decl.used {
+			audit.Unused = append(audit.Unused, decl.dep.Name)
+		}
+	}
+	for _, name := range sortedKeys(testOnly) {
+		if !prodUsesDependency(name, imports) {
+			audit.TestOnly = append(audit.TestOnly, name)
+		}
+	}
+	sort.Strings(audit.Unused)
+
+	return audit, nil
+}
+
+// Clean returns true if the audit found no problems.
+func (a *ImportAudit) Clean() bool {
+	return len(a.Undeclared) == 0 && len(a.Unused) == 0 && len(a.TestOnly) == 0
+}
+
+// WriteJSON writes the audit to the writer as json.
+func (a *ImportAudit) WriteJSON(writer io.Writer) error {
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// collectImports adds the imports of every go file in dir to either imports
+// or testImports depending on whether it's a _test.go file.
+func collectImports(dir string, imports, testImports map[string]bool) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		if exists, err := DirExists(dir); err != nil {
+			return err
+		} else if !exists {
+			return &os.PathError{Op: "audit", Path: dir, Err: os.ErrNotExist}
+		}
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		into := imports
+		if strings.HasSuffix(file, "_test.go") {
+			into = testImports
+		}
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return err
+			}
+			into[imp] = true
+		}
+	}
+	return nil
+}
+
+// isTestEnvironment checks if an environment name is or includes the test
+// environment, ie. test or prod.test
+func isTestEnvironment(env string) bool {
+	for _, part := range strings.Split(env, ".") {
+		if part == testEnvironment {
+			return true
+		}
+	}
+	return false
+}
+
+// isStandardImport checks if the import path belongs to the standard library,
+// which is assumed for any path whose first element contains no dot.
+func isStandardImport(imp string) bool {
+	first := imp
+	if i := strings.IndexByte(imp, '/'); i >= 0 {
+		first = imp[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+// isSelfImport checks if the import refers to the package or one of its
+// subpackages.
+func isSelfImport(p *Pack, imp string) bool {
+	return len(p.ImportPath) > 0 && importMatches(p.ImportPath, imp)
+}
+
+// importMatches checks if the import path is the dependency or a package
+// within it.
+func importMatches(name, imp string) bool {
+	return imp == name || strings.HasPrefix(imp, name+"/")
+}
+
+// prodUsesDependency checks if any non-test import is satisfied by name.
+func prodUsesDependency(name string, imports map[string]bool) bool {
+	for imp := range imports {
+		if importMatches(name, imp) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	. "testing"
+)
+
+var testAuditFiles = map[string]string{
+	"main.go": `package main
+
+import (
+	"fmt"
+	"github.com/user/package/sub"
+	"github.com/dep/one/inner"
+	"github.com/undeclared/pkg"
+)
+`,
+	"main_test.go": `package main
+
+import (
+	"testing"
+	"github.com/dep/testing"
+	"github.com/dep/assert"
+)
+`,
+	"sub/sub.go": `package sub
+
+import "github.com/dep/two"
+`,
+}
+
+func TestAuditImports(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackaudit")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range testAuditFiles {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(filename), 0770); err != nil {
+			t.Fatal("Could not create dir:", err)
+		}
+		if err = ioutil.WriteFile(filename, []byte(contents), 0660); err != nil {
+			t.Fatal("Could not write file:", err)
+		}
+	}
+
+	deps := func(strs ...string) []*Dependency {
+		var ds []*Dependency
+		for _, str := range strs {
+			d, err := ParseDependency(str)
+			if err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+			ds = append(ds, d)
+		}
+		return ds
+	}
+
+	p := &Pack{
+		ImportPath:   "github.com/user/package",
+		Dependencies: deps("github.com/dep/one", "github.com/dep/unused"),
+		Environments: map[string][]*Dependency{
+			"all":  deps("github.com/dep/two", "github.com/dep/testing"),
+			"test": deps("github.com/dep/assert"),
+		},
+		Subpackages: []string{"sub"},
+	}
+
+	audit, err := AuditImports(dir, p)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	exp := []string{"github.com/undeclared/pkg"}
+	if !reflect.DeepEqual(exp, audit.Undeclared) {
+		t.Error("Expected undeclared:", exp, "got:", audit.Undeclared)
+	}
+	exp = []string{"github.com/dep/unused"}
+	if !reflect.DeepEqual(exp, audit.Unused) {
+		t.Error("Expected unused:", exp, "got:", audit.Unused)
+	}
+	exp = []string{"github.com/dep/testing"}
+	if !reflect.DeepEqual(exp, audit.TestOnly) {
+		t.Error("Expected test only:", exp, "got:", audit.TestOnly)
+	}
+	if audit.Clean() {
+		t.Error("Expected the audit to be unclean.")
+	}
+
+	var buf bytes.Buffer
+	if err = audit.WriteJSON(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var decoded ImportAudit
+	if err = json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(*audit, decoded) {
+		t.Error("Expected json to round trip, got:", buf.String())
+	}
+
+	if _, err = AuditImports(filepath.Join(dir, "missing"), p); err == nil {
+		t.Error("Expected an error for a missing directory.")
+	}
+}
+
+func TestAuditImports_Clean(t *T) {
+	t.Parallel()
+
+	audit := &ImportAudit{}
+	if !audit.Clean() {
+		t.Error("Expected an empty audit to be clean.")
+	}
+}
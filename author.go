@@ -0,0 +1,355 @@
+package pack
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	errFmtAuthor = `pack: [%v] authors must be in the form: ` +
+		`name <email> (homepage)`
+	errFmtMailmap = `pack: [%v] mailmap lines must be in the form: ` +
+		`[name] <email> [[name] <email>]`
+)
+
+var (
+	rgxAuthor = regexp.MustCompile(
+		`^([^<>()]*?)\s*((?:<[^<>\s]+>\s*)*)(?:\(([^()\s]+)\))?$`)
+	rgxAuthorEmail = regexp.MustCompile(`<([^<>\s]+)>`)
+	rgxMailmap     = regexp.MustCompile(
+		`^([^<>]*?)\s*<([^<>\s]*)>(?:\s*([^<>]*?)\s*<([^<>\s]+)>)?$`)
+)
+
+// ParseAuthor parses the shorthand form: Name <email> (homepage) into an
+// Author. Every part is optional, but there may be more than one email.
+func ParseAuthor(str string) (*Author, error) {
+	str = strings.TrimSpace(str)
+	parts := rgxAuthor.FindStringSubmatch(str)
+	if len(str) == 0 || parts == nil {
+		return nil, fmt.Errorf(errFmtAuthor, str)
+	}
+
+	a := &Author{Name: parts[1], Homepage: parts[3]}
+	for _, email := range rgxAuthorEmail.FindAllStringSubmatch(parts[2], -1) {
+		a.Emails = append(a.Emails, email[1])
+	}
+	return a, nil
+}
+
+// GetYAML implements the goyaml Getter interface.
+func (a *Author) GetYAML() (_ string, value interface{}) {
+	return "", a.String()
+}
+
+// SetYAML implements the goyaml Setter interface. Both the shorthand string
+// and the long form mapping are accepted.
+func (a *Author) SetYAML(_ string, value interface{}) (ok bool) {
+	switch v := value.(type) {
+	case string:
+		tmp, err := ParseAuthor(v)
+		if ok = tmp != nil && err == nil; !ok {
+			return
+		}
+		*a = *tmp
+	case map[interface{}]interface{}:
+		var tmp Author
+		for key, val := range v {
+			k, isStr := key.(string)
+			if !isStr {
+				return false
+			}
+			if ok = tmp.setField(k, val); !ok {
+				return
+			}
+		}
+		*a = tmp
+		ok = true
+	}
+	return
+}
+
+// MarshalJSON implements the json Marshaler interface.
+func (a *Author) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON implements the json Unmarshaler interface. Both the shorthand
+// string and the long form object are accepted.
+func (a *Author) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		tmp, err := ParseAuthor(str)
+		if err != nil {
+			return err
+		}
+		*a = *tmp
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var tmp Author
+	for key, val := range fields {
+		if !tmp.setField(strings.ToLower(key), val) {
+			return fmt.Errorf(errFmtAuthor, string(data))
+		}
+	}
+	*a = tmp
+	return nil
+}
+
+// setField sets a field of the long form of an author, email is accepted as
+// an alias of emails. Unknown keys are ignored, it returns false only if the
+// value has the wrong type.
+func (a *Author) setField(key string, value interface{}) bool {
+	switch key {
+	case "name":
+		s, ok := value.(string)
+		a.Name = s
+		return ok
+	case "homepage":
+		s, ok := value.(string)
+		a.Homepage = s
+		return ok
+	case "email", "emails":
+		switch v := value.(type) {
+		case string:
+			a.Emails = append(a.Emails, v)
+		case []interface{}:
+			for _, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return false
+				}
+				a.Emails = append(a.Emails, s)
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Mailmap maps the identities used by an author to their canonical identity,
+// in the style of git's .mailmap file.
+type Mailmap struct {
+	entries []mailmapEntry
+}
+
+// mailmapEntry is a single line of a mailmap.
+type mailmapEntry struct {
+	properName  string
+	properEmail string
+	commitName  string
+	commitEmail string
+}
+
+// ParseMailmap reads a mailmap. Each line is one of the forms below, and
+// blank lines and # comments are ignored.
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func ParseMailmap(reader io.Reader) (*Mailmap, error) {
+	m := &Mailmap{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		parts := rgxMailmap.FindStringSubmatch(line)
+		if parts == nil {
+			return nil, fmt.Errorf(errFmtMailmap, line)
+		}
+
+		entry := mailmapEntry{properName: parts[1]}
+		if len(parts[4]) == 0 {
+			entry.commitEmail = parts[2]
+		} else {
+			entry.properEmail = parts[2]
+			entry.commitName = parts[3]
+			entry.commitEmail = parts[4]
+		}
+		m.entries = append(m.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add adds an alias so that the alias email (and optionally only when used
+// with the alias name) maps to the proper name and email. Empty proper values
+// are left unchanged when mapping.
+func (m *Mailmap) Add(properName, properEmail, aliasName, aliasEmail string) {
+	m.entries = append(m.entries, mailmapEntry{
+		properName:  properName,
+		properEmail: properEmail,
+		commitName:  aliasName,
+		commitEmail: aliasEmail,
+	})
+}
+
+// Map returns the canonical name and email for the given name and email. The
+// last matching entry wins, entries that specify a name are preferred.
+func (m *Mailmap) Map(name, email string) (string, string) {
+	var match *mailmapEntry
+	for i := range m.entries {
+		e := &m.entries[i]
+		if !strings.EqualFold(e.commitEmail, email) {
+			continue
+		}
+		if len(e.commitName) > 0 {
+			if e.commitName != name {
+				continue
+			}
+		} else if match != nil && len(match.commitName) > 0 {
+			continue
+		}
+		match = e
+	}
+
+	if match == nil {
+		return name, email
+	}
+	if len(match.properName) > 0 {
+		name = match.properName
+	}
+	if len(match.properEmail) > 0 {
+		email = match.properEmail
+	}
+	return name, email
+}
+
+// MergeIdentities combines Authors and Contributors that share an email
+// address (case insensitively) into a single identity. Merging is
+// transitive, an entry with the emails of two identities joins them. Entries
+// without emails are only combined with others of the same name that also
+// have none. The mailmap is optional, when it's present every name and email
+// is first mapped through it. An identity that is both an author and a
+// contributor is kept only as an author.
+func (p *Pack) MergeIdentities(m *Mailmap) {
+	var entries []*Author
+	for _, a := range p.Authors {
+		entries = append(entries, canonicalAuthor(a, m))
+	}
+	nAuthors := len(entries)
+	for _, a := range p.Contributors {
+		entries = append(entries, canonicalAuthor(a, m))
+	}
+
+	// parent is a union find forest over the entries, each group's root is
+	// its first entry.
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		i, j = find(i), find(j)
+		if i > j {
+			i, j = j, i
+		}
+		parent[j] = i
+	}
+
+	byEmail := make(map[string]int)
+	byName := make(map[string]int)
+	for i, a := range entries {
+		if len(a.Emails) == 0 {
+			if len(a.Name) == 0 {
+				continue
+			}
+			if j, ok := byName[a.Name]; ok {
+				union(j, i)
+			} else {
+				byName[a.Name] = i
+			}
+			continue
+		}
+		for _, email := range a.Emails {
+			key := strings.ToLower(email)
+			if j, ok := byEmail[key]; ok {
+				union(j, i)
+			} else {
+				byEmail[key] = i
+			}
+		}
+	}
+
+	merged := make(map[int]*Author)
+	isAuthor := make(map[int]bool)
+	var order []int
+	seen := make(map[string]bool)
+	for i, a := range entries {
+		root := find(i)
+		into, ok := merged[root]
+		if !ok {
+			into = &Author{}
+			merged[root] = into
+			order = append(order, root)
+		}
+		if i < nAuthors {
+			isAuthor[root] = true
+		}
+		if len(into.Name) == 0 {
+			into.Name = a.Name
+		}
+		if len(into.Homepage) == 0 {
+			into.Homepage = a.Homepage
+		}
+		for _, email := range a.Emails {
+			key := strings.ToLower(email)
+			if !seen[key] {
+				seen[key] = true
+				into.Emails = append(into.Emails, email)
+			}
+		}
+	}
+
+	p.Authors, p.Contributors = nil, nil
+	for _, root := range order {
+		if isAuthor[root] {
+			p.Authors = append(p.Authors, merged[root])
+		} else {
+			p.Contributors = append(p.Contributors, merged[root])
+		}
+	}
+}
+
+// canonicalAuthor copies an author, mapping each of its emails through the
+// mailmap. The name is taken from the first email that maps to a new one.
+func canonicalAuthor(a *Author, m *Mailmap) *Author {
+	c := &Author{Name: a.Name, Homepage: a.Homepage}
+	renamed := false
+	for _, email := range a.Emails {
+		name, mapped := a.Name, email
+		if m != nil {
+			name, mapped = m.Map(a.Name, email)
+		}
+		if !renamed && name != a.Name {
+			c.Name = name
+			renamed = true
+		}
+		c.Emails = append(c.Emails, mapped)
+	}
+	return c
+}
@@ -0,0 +1,231 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	. "testing"
+)
+
+func TestParseAuthor(t *T) {
+	t.Parallel()
+
+	var tests = []struct {
+		Input  string
+		Output Author
+		Error  bool
+	}{
+		{``, Author{}, true},
+		{`Jane Doe`, Author{Name: "Jane Doe"}, false},
+		{`Jane Doe <jane@x.com>`,
+			Author{"Jane Doe", []string{"jane@x.com"}, ""}, false},
+		{`Jane Doe <jane@x.com> (https://jane.dev)`,
+			Author{"Jane Doe", []string{"jane@x.com"}, "https://jane.dev"}, false},
+		{`Jane Doe <jane@x.com> <jd@y.com>`,
+			Author{"Jane Doe", []string{"jane@x.com", "jd@y.com"}, ""}, false},
+		{`<jane@x.com>`, Author{Emails: []string{"jane@x.com"}}, false},
+		{`Jane (https://jane.dev)`,
+			Author{Name: "Jane", Homepage: "https://jane.dev"}, false},
+		{`Jane <jane@x.com`, Author{}, true},
+		{`Jane (jane) <jane@x.com>`, Author{}, true},
+	}
+
+	for _, test := range tests {
+		a, err := ParseAuthor(test.Input)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%q: expected an error.", test.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Input, err)
+		} else if !reflect.DeepEqual(*a, test.Output) {
+			t.Errorf("%q: expected: %#v, got: %#v", test.Input, test.Output, *a)
+		}
+	}
+}
+
+func TestAuthor_YAML(t *T) {
+	t.Parallel()
+
+	var a Author
+	if a.SetYAML("", 10) {
+		t.Error("Expecting failure.")
+	}
+	if !a.SetYAML("", "Jane Doe <jane@x.com> (https://jane.dev)") {
+		t.Error("Expecting success.")
+	}
+	_, value := a.GetYAML()
+	if value != "Jane Doe <jane@x.com> (https://jane.dev)" {
+		t.Error("Unexpected value:", value)
+	}
+
+	a = Author{}
+	ok := a.SetYAML("", map[interface{}]interface{}{
+		"name":     "Jane Doe",
+		"email":    "jane@x.com",
+		"homepage": "https://jane.dev",
+	})
+	if !ok {
+		t.Error("Expecting success.")
+	}
+	exp := Author{"Jane Doe", []string{"jane@x.com"}, "https://jane.dev"}
+	if !reflect.DeepEqual(a, exp) {
+		t.Error("Expected:", exp, "got:", a)
+	}
+
+	if a.SetYAML("", map[interface{}]interface{}{"name": 5}) {
+		t.Error("Expecting failure.")
+	}
+}
+
+func TestAuthor_PackRoundTrip(t *T) {
+	t.Parallel()
+
+	p := mustParsePack(t, `authors:
+- Jane Doe <jane@x.com> (https://jane.dev)
+- name: John
+  emails:
+  - john@x.com
+contributors:
+- Contrib <contrib@x.com>
+`)
+	if len(p.Authors) != 2 || len(p.Contributors) != 1 {
+		t.Fatal("Expected authors and contributors, got:", p)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteTo(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "John <john@x.com>") {
+		t.Error("Expected authors to be written in shorthand, got:\n", out)
+	}
+}
+
+func TestAuthor_JSON(t *T) {
+	t.Parallel()
+
+	var authors []*Author
+	err := json.Unmarshal([]byte(`["Jane <jane@x.com>",`+
+		`{"name": "John", "emails": ["john@x.com"]}]`), &authors)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(authors) != 2 || authors[1].Name != "John" {
+		t.Fatal("Unexpected authors:", authors)
+	}
+
+	out, err := json.Marshal(authors)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var strs []string
+	if err = json.Unmarshal(out, &strs); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	exp := []string{"Jane <jane@x.com>", "John <john@x.com>"}
+	if !reflect.DeepEqual(strs, exp) {
+		t.Error("Expected:", exp, "got:", strs)
+	}
+
+	var a Author
+	if err = json.Unmarshal([]byte(`"Jane <jane"`), &a); err == nil {
+		t.Error("Expected an error.")
+	}
+}
+
+func TestParseMailmap(t *T) {
+	t.Parallel()
+
+	m, err := ParseMailmap(bytes.NewBufferString(`# comment
+Jane Doe <jane@old.com>
+<john@new.com> <john@old.com>
+Jane Doe <jane@x.com> <jane@work.com>
+Proper <proper@x.com> Alias <shared@x.com> # trailing
+`))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var tests = []struct {
+		Name, Email       string
+		ExpName, ExpEmail string
+	}{
+		{"jane", "jane@old.com", "Jane Doe", "jane@old.com"},
+		{"John", "JOHN@old.com", "John", "john@new.com"},
+		{"J", "jane@work.com", "Jane Doe", "jane@x.com"},
+		{"Alias", "shared@x.com", "Proper", "proper@x.com"},
+		{"Other", "shared@x.com", "Other", "shared@x.com"},
+		{"Nobody", "nobody@x.com", "Nobody", "nobody@x.com"},
+	}
+	for _, test := range tests {
+		name, email := m.Map(test.Name, test.Email)
+		if name != test.ExpName || email != test.ExpEmail {
+			t.Errorf("%s <%s>: expected: %s <%s>, got: %s <%s>",
+				test.Name, test.Email, test.ExpName, test.ExpEmail, name, email)
+		}
+	}
+
+	if _, err = ParseMailmap(bytes.NewBufferString("no email")); err == nil {
+		t.Error("Expected an error.")
+	}
+}
+
+func TestPack_MergeIdentities(t *T) {
+	t.Parallel()
+
+	p := mustParsePack(t, `authors:
+- Jane Doe <jane@x.com>
+- J. Doe <JANE@x.com> (https://jane.dev)
+- Jane <jane@work.com>
+- Bob
+contributors:
+- Jane <jane@x.com>
+- Bob
+- Alice <alice@x.com>
+`)
+
+	m := &Mailmap{}
+	m.Add("", "jane@x.com", "", "jane@work.com")
+	p.MergeIdentities(m)
+
+	if ln := len(p.Authors); ln != 2 {
+		t.Fatal("Expected 2 authors, got:", p.Authors)
+	}
+	exp := Author{"Jane Doe", []string{"jane@x.com"}, "https://jane.dev"}
+	if !reflect.DeepEqual(*p.Authors[0], exp) {
+		t.Error("Expected:", exp, "got:", *p.Authors[0])
+	}
+	if ln := len(p.Contributors); ln != 1 {
+		t.Fatal("Expected 1 contributor, got:", p.Contributors)
+	} else if p.Contributors[0].Name != "Alice" {
+		t.Error("Expected Alice, got:", p.Contributors[0])
+	}
+}
+
+func TestPack_MergeIdentitiesTransitive(t *T) {
+	t.Parallel()
+
+	p := mustParsePack(t, `authors:
+- A <a@x.com>
+- B <b@x.com>
+contributors:
+- AB <a@x.com> <b@x.com>
+- C <c@x.com>
+`)
+	p.MergeIdentities(nil)
+
+	if ln := len(p.Authors); ln != 1 {
+		t.Fatal("Expected 1 author, got:", p.Authors)
+	}
+	exp := Author{"A", []string{"a@x.com", "b@x.com"}, ""}
+	if !reflect.DeepEqual(*p.Authors[0], exp) {
+		t.Error("Expected:", exp, "got:", *p.Authors[0])
+	}
+	if ln := len(p.Contributors); ln != 1 || p.Contributors[0].Name != "C" {
+		t.Error("Expected only C as a contributor, got:", p.Contributors)
+	}
+}
@@ -0,0 +1,287 @@
+package pack
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// CACHEFOLDER is the folder in the GopackPath that holds the cache.
+	CACHEFOLDER = "cache"
+	// DefaultCacheTTL is how long a cached tag list is used before the
+	// repository is checked for new tags.
+	DefaultCacheTTL = time.Hour
+
+	// cacheVersionsFile holds the tag list of a repository.
+	cacheVersionsFile = "versions.yaml"
+	// cachePackExt is the extension of the cached pack of each version.
+	cachePackExt = ".yaml"
+)
+
+// cachedVersions is the tag list of a repository as it is stored on disk.
+type cachedVersions struct {
+	// RefState is the state of the repository's tags when the list was
+	// fetched.
+	RefState string `yaml:"refstate,omitempty"`
+	// Fetched is when the list was fetched or last confirmed unchanged, in
+	// seconds since the unix epoch.
+	Fetched  int64
+	Versions []string
+}
+
+// Cache is a VersionSource that stores what another VersionSource returns
+// on disk so that it survives between runs. The pack of a version never
+// changes so it is cached forever. The list of versions is used for TTL and
+// then refreshed. When RefState is set it is consulted first, and if the
+// repository's tags have not changed the list is kept for another TTL without
+// asking Source.
+type Cache struct {
+	// Dir is the directory the cache is stored in.
+	Dir string
+	// Source is where metadata that is not cached comes from.
+	Source VersionSource
+	// TTL is how long a list of versions is used, lists never expire when it
+	// is negative.
+	TTL time.Duration
+	// Refresh ignores cached lists of versions, they are fetched and cached
+	// again. Cached packs are still used.
+	Refresh bool
+	// RefState, if set, describes the state of the tags Source lists for a
+	// package, so it must look at the same repository Source does. It
+	// should be much cheaper than listing versions through Source.
+	RefState func(ctx context.Context, name string) (string, error)
+	// Root, if set, returns the import path of a package's repository. The
+	// packages of a repository are then cached together, since Source must
+	// give them the same tags and packs. A package whose root can't be found
+	// is cached by its name.
+	Root func(name string) (string, error)
+
+	now func() time.Time
+}
+
+// NewCache creates a cache of source in the GopackPath with the default TTL.
+// Packages are cached by the root of their repository in the paths.
+func NewCache(paths *Paths, source VersionSource) *Cache {
+	return &Cache{
+		Dir:    filepath.Join(paths.GopackPath, CACHEFOLDER),
+		Source: source,
+		TTL:    DefaultCacheTTL,
+		Root:   OpenerRoot(PathsOpener(paths)),
+	}
+}
+
+// OpenerRoot returns a function to use as Cache.Root that finds the root of
+// a package's repository with open.
+func OpenerRoot(open Opener) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		_, root, err := open(name)
+		return root, err
+	}
+}
+
+// DVCSRefState returns a function to use as Cache.RefState that opens the
+// repository of a package with open. The state is that of the remote's tags.
+// When the repository is missing some of them they are fetched if it
+// implements TagFetcher, so that the tags listed from it match the state,
+// and otherwise the state is empty. Repositories that don't implement
+// RefStater have an empty state too, which is never considered unchanged.
+func DVCSRefState(open Opener) func(ctx context.Context, name string) (
+	string, error) {
+
+	return func(ctx context.Context, name string) (string, error) {
+		dvcs, _, err := open(name)
+		if err != nil {
+			return "", err
+		}
+		stater, ok := dvcs.(RefStater)
+		if !ok {
+			return "", nil
+		}
+
+		remote, err := stater.RefState(ctx)
+		if err != nil {
+			return "", err
+		}
+		local, err := stater.LocalRefState(ctx)
+		if err != nil || local == remote {
+			return remote, err
+		}
+
+		fetcher, ok := dvcs.(TagFetcher)
+		if !ok {
+			return "", nil
+		}
+		if err = fetcher.FetchTags(ctx); err != nil {
+			return "", err
+		}
+		if local, err = stater.LocalRefState(ctx); err != nil {
+			return "", err
+		} else if local != remote {
+			return "", nil
+		}
+		return remote, nil
+	}
+}
+
+// Versions returns the cached versions of a package, fetching them from the
+// source if they are not cached, have expired or Refresh is set.
+func (c *Cache) Versions(ctx context.Context, name string) ([]*Version,
+	error) {
+
+	filename := c.filename(name, cacheVersionsFile)
+	var cached cachedVersions
+	found, err := readCacheFile(filename, &cached)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.clock()
+	fresh := found && !c.Refresh && (c.TTL < 0 ||
+		now.Sub(time.Unix(cached.Fetched, 0)) < c.TTL)
+
+	var state string
+	stated := false
+	if found && !fresh && !c.Refresh && c.RefState != nil {
+		if state, err = c.RefState(ctx, name); err != nil {
+			return nil, err
+		}
+		stated = true
+		if len(state) > 0 && state == cached.RefState {
+			fresh = true
+			cached.Fetched = now.Unix()
+			if err = writeCacheFile(filename, &cached); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if fresh {
+		return parseVersions(cached.Versions)
+	}
+
+	if !stated && c.RefState != nil {
+		if state, err = c.RefState(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	versions, err := c.Source.Versions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cached = cachedVersions{RefState: state, Fetched: now.Unix()}
+	for _, v := range versions {
+		cached.Versions = append(cached.Versions, v.String())
+	}
+	if err = writeCacheFile(filename, &cached); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Pack returns the cached pack of a package at a version, fetching it from
+// the source if it is not cached.
+func (c *Cache) Pack(ctx context.Context, name string, version *Version) (
+	*Pack, error) {
+
+	filename := c.filename(name, version.String()+cachePackExt)
+	p, err := ParsePackFile(filename)
+	if err == nil {
+		return p, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if p, err = c.Source.Pack(ctx, name, version); err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = &Pack{}
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0770); err != nil {
+		return nil, err
+	}
+	if err = p.WritePackFile(filename); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Clear removes everything that is cached for a package, which is also
+// everything cached for the other packages of its repository.
+func (c *Cache) Clear(name string) error {
+	return os.RemoveAll(filepath.Dir(c.filename(name, cacheVersionsFile)))
+}
+
+// filename is the path of a file in the cache directory of a package, which
+// is named after the root of its repository if Root is set. Names are
+// escaped so that a repository doesn't share a directory with another nested
+// in it.
+func (c *Cache) filename(name, file string) string {
+	if c.Root != nil {
+		if root, err := c.Root(name); err == nil && len(root) > 0 {
+			name = root
+		}
+	}
+	return filepath.Join(c.Dir, url.PathEscape(name), file)
+}
+
+// clock returns the current time.
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// parseVersions parses a list of versions.
+func parseVersions(strs []string) ([]*Version, error) {
+	versions := make([]*Version, 0, len(strs))
+	for _, str := range strs {
+		v, err := ParseVersion(str)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// readCacheFile reads a yaml file into out, it returns false if the file does
+// not exist.
+func readCacheFile(filename string, out interface{}) (bool, error) {
+	read, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err = goyaml.Unmarshal(read, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeCacheFile writes in as yaml to a file atomically, creating its
+// directory if needed.
+func writeCacheFile(filename string, in interface{}) error {
+	written, err := goyaml.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0770); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		n, err := w.Write(written)
+		if err == nil && n != len(written) {
+			err = errPartialWrite
+		}
+		return err
+	})
+}
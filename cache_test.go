@@ -0,0 +1,219 @@
+package pack
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	. "testing"
+	"time"
+)
+
+func TestCache(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackcache")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	memory := NewMemorySource()
+	if err = memory.AddVersion("host/a", "1.0.0", "b >=1.0.0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	source := &countingSource{
+		VersionSource: memory,
+		fail:          make(map[string]bool),
+		calls:         make(map[string]int),
+	}
+
+	paths, err := NewPaths(dir, "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	now := time.Unix(1000, 0)
+	cache := NewCache(paths, source)
+	cache.now = func() time.Time { return now }
+	if cache.Dir != filepath.Join(dir, GOPACKFOLDER, CACHEFOLDER) {
+		t.Error("Unexpected cache dir:", cache.Dir)
+	}
+
+	var check = func(versions, packs int) {
+		vs, err := cache.Versions(context.Background(), "host/a")
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		p, err := cache.Pack(context.Background(), "host/a", vs[len(vs)-1])
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if len(p.Dependencies) != 1 {
+			t.Error("Unexpected pack:", p)
+		}
+		if got := source.calls["host/a"]; got != versions {
+			t.Errorf("Expected %d version lookups, got: %d", versions, got)
+		}
+		if got := source.calls["host/a@1.0.0"]; got != packs {
+			t.Errorf("Expected %d pack lookups, got: %d", packs, got)
+		}
+	}
+
+	check(1, 1)
+	check(1, 1)
+
+	// A new cache reads what the first one stored.
+	second := NewCache(paths, source)
+	second.now = cache.now
+	vs, err := second.Versions(context.Background(), "host/a")
+	if err != nil || len(vs) != 1 {
+		t.Error("Expected the cached versions, got:", vs, err)
+	}
+	check(1, 1)
+
+	now = now.Add(DefaultCacheTTL)
+	check(2, 1)
+
+	cache.Refresh = true
+	check(3, 1)
+	cache.Refresh = false
+
+	// An unchanged ref state extends the list without asking the source.
+	state := "one"
+	cache.RefState = func(context.Context, string) (string, error) {
+		return state, nil
+	}
+	now = now.Add(DefaultCacheTTL)
+	check(4, 1)
+	now = now.Add(DefaultCacheTTL)
+	check(4, 1)
+	state = "two"
+	now = now.Add(DefaultCacheTTL)
+	check(5, 1)
+
+	if err = cache.Clear("host/a"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	check(6, 2)
+}
+
+func TestDVCSRefState(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopackrefs")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	gitTestRepo(t, dir)
+
+	refState := DVCSRefState(func(name string) (DVCS, string, error) {
+		return NewGit(dir), name, nil
+	})
+	first, err := refState(context.Background(), "a")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(first) == 0 {
+		t.Error("Expected a ref state.")
+	}
+	if second, _ := refState(context.Background(), "a"); second != first {
+		t.Error("Expected the same ref state, got:", second)
+	}
+
+	if err = NewGit(dir).Checkout("1.0.0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if third, _ := refState(context.Background(), "a"); third != first {
+		t.Error("Expected a checkout not to change the ref state.")
+	}
+
+	cmd := exec.Command("git", "tag", "2.0.0")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, out)
+	}
+	if fourth, _ := refState(context.Background(), "a"); fourth == first {
+		t.Error("Expected a new tag to change the ref state.")
+	}
+}
+
+func TestCache_RemoteTag(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopackrefs")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	origin, clone := filepath.Join(dir, "origin"), filepath.Join(dir, "clone")
+	if err = os.MkdirAll(origin, 0770); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	gitTestRepo(t, origin)
+	if err = NewGit(clone).Clone(origin); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	opened := 0
+	open := func(name string) (DVCS, string, error) {
+		opened++
+		return NewGit(clone), "a", nil
+	}
+	now := time.Unix(1000, 0)
+	cache := &Cache{
+		Dir:      filepath.Join(dir, CACHEFOLDER),
+		TTL:      DefaultCacheTTL,
+		RefState: DVCSRefState(open),
+		Root:     OpenerRoot(open),
+		now:      func() time.Time { return now },
+	}
+	var check = func(name string, exp int) {
+		// DVCSSource keeps the tags it read, a new one reads them again.
+		cache.Source = NewDVCSSource(open)
+		vs, err := cache.Versions(context.Background(), name)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if len(vs) != exp {
+			t.Errorf("Expected %d versions, got: %v", exp, vs)
+		}
+	}
+	check("a", 3)
+
+	// A subpackage uses the list cached for its repository.
+	opened = 0
+	check("a/sub", 3)
+	if opened != 1 {
+		t.Error("Expected only the root to be looked up, got:", opened)
+	}
+
+	cmd := exec.Command("git", "tag", "2.0.0")
+	cmd.Dir = origin
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, out)
+	}
+	check("a", 3)
+
+	// Once the list is checked the clone fetches the tag, and the list is
+	// read again.
+	now = now.Add(DefaultCacheTTL)
+	check("a", 4)
+	if tags, err := NewGit(clone).Tags(); err != nil || len(tags) != 4 {
+		t.Error("Expected the clone to have fetched the tag, got:", tags, err)
+	}
+	now = now.Add(DefaultCacheTTL)
+	check("a/sub", 4)
+}
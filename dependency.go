@@ -12,12 +12,19 @@ const (
 		`importpath [constraints]* [url]?`
 	errFmtConstraint = `pack: [%v] constraints must have the form: ` +
 		`(=|!=|>|<|>=|<=|~)version`
-	errFmtUrl = `pack: [%v] urls must have the form: (git|hg|bzr)(:url)?`
+	errFmtUrl = `pack: [%v] urls must have the form: (git|hg|bzr|svn)(:url)?`
 )
 
 var (
 	rgxDepUrl = regexp.MustCompile(
-		`(?i)^(git|bzr|hg)(?::([a-z0-9\?\-_@\.:/=%&]+))?$`)
+		`(?i)^(git|bzr|hg|svn)(?::([a-z0-9\?\-_@\.:/=%&]+))?$`)
+	// urlTypes maps the type in a dependency url to a Repository.Type.
+	urlTypes = map[string]string{
+		"git": VCSGit,
+		"hg":  VCSMercurial,
+		"bzr": VCSBazaar,
+		"svn": VCSSubversion,
+	}
 	rgxConstraint = regexp.MustCompile(
 		`(?i)^(=|!=|>|<|>=|<=|~)?([0-9]\.[0-9]+\.[0-9]+(?:-[a-z0-9\-\.]+)?)$`)
 )
@@ -25,7 +32,7 @@ var (
 // Dependency is a package dependency.
 type Dependency struct {
 	Name        string
-	Constraints []*Constraint
+	Constraints Constraints
 	URL         string
 }
 
@@ -35,6 +42,9 @@ type Constraint struct {
 	Version  *Version
 }
 
+// Constraints is a list of constraints that must all be satisfied.
+type Constraints []*Constraint
+
 // ParseDependency parses a string into a Dependency.
 func ParseDependency(str string) (*Dependency, error) {
 	var dep *Dependency
@@ -99,6 +109,17 @@ func ParseDependency(str string) (*Dependency, error) {
 	return dep, nil
 }
 
+// CloneURL splits the dependency's url into the Repository.Type of its
+// repository and the url it is cloned from. The url is empty when only the
+// type was given, both are empty when there is no url.
+func (d *Dependency) CloneURL() (vcs, url string) {
+	parts := rgxDepUrl.FindStringSubmatch(d.URL)
+	if parts == nil {
+		return "", ""
+	}
+	return urlTypes[strings.ToLower(parts[1])], parts[2]
+}
+
 // String turns a Dependency into a String.
 func (d *Dependency) String() (str string) {
 	var buf bytes.Buffer
@@ -139,3 +160,86 @@ func (d *Dependency) SetYAML(_ string, value interface{}) (ok bool) {
 	}
 	return
 }
+
+// ParseConstraint parses a string in the form: (=|!=|>|<|>=|<=|~)version into
+// a Constraint. If the operator is omitted it is =.
+func ParseConstraint(str string) (*Constraint, error) {
+	opVersion := rgxConstraint.FindStringSubmatch(str)
+	if opVersion == nil {
+		return nil, fmt.Errorf(errFmtConstraint, str)
+	}
+
+	var err error
+	con := &Constraint{Operator: Equal}
+	if len(opVersion[1]) > 0 {
+		if con.Operator, err = ParseOp(opVersion[1]); err != nil {
+			return nil, err
+		}
+	}
+	if con.Version, err = ParseVersion(opVersion[2]); err != nil {
+		return nil, err
+	}
+	return con, nil
+}
+
+// String turns a Constraint into a string.
+func (c *Constraint) String() string {
+	return c.Operator.String() + c.Version.String()
+}
+
+// Satisfied checks if the version satisfies the constraint.
+func (c *Constraint) Satisfied(v *Version) bool {
+	return v.Satisfies(c.Operator, c.Version)
+}
+
+// ParseConstraints parses a space separated list of constraints.
+func ParseConstraints(str string) (Constraints, error) {
+	var cons Constraints
+	for _, part := range strings.Fields(str) {
+		con, err := ParseConstraint(part)
+		if err != nil {
+			return nil, err
+		}
+		cons = append(cons, con)
+	}
+	return cons, nil
+}
+
+// String turns the constraints into a space separated string.
+func (c Constraints) String() string {
+	strs := make([]string, len(c))
+	for i, con := range c {
+		strs[i] = con.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+// Satisfied checks if the version satisfies every constraint.
+func (c Constraints) Satisfied(v *Version) bool {
+	for _, con := range c {
+		if !con.Satisfied(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetYAML implements the goyaml Getter interface.
+func (c Constraints) GetYAML() (_ string, value interface{}) {
+	return "", c.String()
+}
+
+// SetYAML implements the goyaml Setter interface.
+func (c *Constraints) SetYAML(_ string, value interface{}) (ok bool) {
+	var s string
+	var err error
+	var tmp Constraints
+	if s, ok = value.(string); ok {
+		tmp, err = ParseConstraints(s)
+		if ok = err == nil; !ok {
+			return
+		}
+		*c = tmp
+	}
+	return
+}
@@ -70,6 +70,21 @@ func TestParseDependency(t *T) {
 	if out.URL != "git:http://repo.com" {
 		t.Error("Expected the repo url but got:", out.URL)
 	}
+
+	out, err = ParseDependency(`name svn:file:///var/svn/repo`)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if out.URL != "svn:file:///var/svn/repo" {
+		t.Error("Expected the repo url but got:", out.URL)
+	}
+
+	if vcs, url := out.CloneURL(); vcs != VCSSubversion ||
+		url != "file:///var/svn/repo" {
+
+		t.Error("Unexpected clone url:", vcs, url)
+	}
 }
 
 func TestParseDependency_Errors(t *T) {
@@ -161,3 +176,65 @@ func TestDependency_SetYAML(t *T) {
 		t.Error("Expected:", c.Version, "to match", comp)
 	}
 }
+
+func TestParseConstraints(t *T) {
+	t.Parallel()
+
+	cons, err := ParseConstraints(">=1.2.0  <2.0.0 !=1.5.0-pre")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if ln := len(cons); ln != 3 {
+		t.Fatal("Expected 3 constraints, got:", ln)
+	}
+	if s, exp := cons.String(), ">=1.2.0 <2.0.0 !=1.5.0-pre"; s != exp {
+		t.Error("Expected:", exp, "got:", s)
+	}
+
+	var tests = []struct {
+		Version string
+		Result  bool
+	}{
+		{"1.2.0", true},
+		{"1.9.9", true},
+		{"1.1.9", false},
+		{"2.0.0", false},
+		{"1.5.0-pre", false},
+	}
+	for _, test := range tests {
+		v, _ := ParseVersion(test.Version)
+		if ok := cons.Satisfied(v); ok != test.Result {
+			t.Errorf("%s: expected: %v, got: %v", test.Version, test.Result, ok)
+		}
+	}
+
+	if con, err := ParseConstraint("1.2.3"); err != nil {
+		t.Error("Unexpected error:", err)
+	} else if con.Operator != Equal {
+		t.Error("Expected the default operator to be =, got:", con.Operator)
+	}
+	if _, err = ParseConstraints(">=1.2.0 nope"); err == nil {
+		t.Error("Expected an error.")
+	}
+	if cons, err = ParseConstraints(""); err != nil || len(cons) != 0 {
+		t.Error("Expected no constraints, got:", cons, err)
+	}
+}
+
+func TestConstraints_YAML(t *T) {
+	t.Parallel()
+
+	var cons Constraints
+	if cons.SetYAML("", 10) {
+		t.Error("Expecting failure.")
+	}
+	if cons.SetYAML("", "~1") {
+		t.Error("Expecting failure.")
+	}
+	if !cons.SetYAML("", "~1.2.0 !=1.3.0") {
+		t.Error("Expecting success.")
+	}
+	if _, value := cons.GetYAML(); value != "~1.2.0 !=1.3.0" {
+		t.Error("Unexpected value:", value)
+	}
+}
@@ -0,0 +1,370 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind describes how something differs between two packs.
+type ChangeKind string
+
+// Defines the kinds of changes.
+const (
+	// Added means it exists only in the new pack.
+	Added ChangeKind = "added"
+	// Removed means it exists only in the old pack.
+	Removed ChangeKind = "removed"
+	// Changed means it exists in both but differs.
+	Changed ChangeKind = "changed"
+)
+
+// FieldChange is a change to a metadata field of a pack.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DependencyChange is a change to a dependency within an environment. The
+// default Dependencies of a pack have an empty Environment.
+type DependencyChange struct {
+	Environment string     `json:"environment"`
+	Name        string     `json:"name"`
+	Kind        ChangeKind `json:"kind"`
+	Old         string     `json:"old,omitempty"`
+	New         string     `json:"new,omitempty"`
+}
+
+// PackDiff is the structured difference between two packs.
+type PackDiff struct {
+	Fields              []*FieldChange      `json:"fields"`
+	AuthorsAdded        []string            `json:"authorsAdded"`
+	AuthorsRemoved      []string            `json:"authorsRemoved"`
+	ContributorsAdded   []string            `json:"contributorsAdded"`
+	ContributorsRemoved []string            `json:"contributorsRemoved"`
+	Dependencies        []*DependencyChange `json:"dependencies"`
+}
+
+// DiffPacks computes the changes required to go from pack a to pack b. Either
+// pack may be nil, in which case it's treated as empty.
+func DiffPacks(a, b *Pack) *PackDiff {
+	if a == nil {
+		a = &Pack{}
+	}
+	if b == nil {
+		b = &Pack{}
+	}
+
+	d := &PackDiff{
+		Fields:       []*FieldChange{},
+		Dependencies: []*DependencyChange{},
+	}
+
+	oldFields, newFields := packFields(a), packFields(b)
+	oldExt, newExt := extensionFields(a, b), extensionFields(b, a)
+	oldFields = append(oldFields, oldExt...)
+	newFields = append(newFields, newExt...)
+	for i, field := range oldFields {
+		if field.value != newFields[i].value {
+			d.Fields = append(d.Fields, &FieldChange{
+				Field: field.name,
+				Old:   field.value,
+				New:   newFields[i].value,
+			})
+		}
+	}
+
+	d.AuthorsAdded, d.AuthorsRemoved = diffAuthors(a.Authors, b.Authors)
+	d.ContributorsAdded, d.ContributorsRemoved =
+		diffAuthors(a.Contributors, b.Contributors)
+
+	d.Dependencies = append(d.Dependencies,
+		diffDependencies("", a.Dependencies, b.Dependencies)...)
+
+	envs := make(map[string]bool)
+	for env := range a.Environments {
+		envs[env] = true
+	}
+	for env := range b.Environments {
+		envs[env] = true
+	}
+	for _, env := range sortedKeys(envs) {
+		d.Dependencies = append(d.Dependencies, diffDependencies(env,
+			a.Environments[env], b.Environments[env])...)
+	}
+
+	return d
+}
+
+// Empty checks if there are no differences.
+func (d *PackDiff) Empty() bool {
+	return len(d.Fields) == 0 &&
+		len(d.AuthorsAdded) == 0 && len(d.AuthorsRemoved) == 0 &&
+		len(d.ContributorsAdded) == 0 && len(d.ContributorsRemoved) == 0 &&
+		len(d.Dependencies) == 0
+}
+
+// String renders the diff as plain text.
+func (d *PackDiff) String() string {
+	var buf bytes.Buffer
+	for _, f := range d.Fields {
+		fmt.Fprintf(&buf, "~ %s: %s -> %s\n", f.Field, quoteEmpty(f.Old),
+			quoteEmpty(f.New))
+	}
+	writeList := func(prefix, what string, list []string) {
+		for _, item := range list {
+			fmt.Fprintf(&buf, "%s %s: %s\n", prefix, what, item)
+		}
+	}
+	writeList("+", "author", d.AuthorsAdded)
+	writeList("-", "author", d.AuthorsRemoved)
+	writeList("+", "contributor", d.ContributorsAdded)
+	writeList("-", "contributor", d.ContributorsRemoved)
+	for _, dep := range d.Dependencies {
+		env := environmentLabel(dep.Environment)
+		switch dep.Kind {
+		case Added:
+			fmt.Fprintf(&buf, "+ %s: %s\n", env, dep.New)
+		case Removed:
+			fmt.Fprintf(&buf, "- %s: %s\n", env, dep.Old)
+		case Changed:
+			fmt.Fprintf(&buf, "~ %s: %s -> %s\n", env, dep.Old, dep.New)
+		}
+	}
+	return buf.String()
+}
+
+// Markdown renders the diff as a markdown document.
+func (d *PackDiff) Markdown() string {
+	var buf bytes.Buffer
+	if len(d.Fields) > 0 {
+		buf.WriteString("### Metadata\n\n")
+		buf.WriteString("| Field | Old | New |\n|---|---|---|\n")
+		for _, f := range d.Fields {
+			fmt.Fprintf(&buf, "| %s | %s | %s |\n", f.Field,
+				markdownCell(f.Old), markdownCell(f.New))
+		}
+		buf.WriteByte('\n')
+	}
+
+	writeList := func(title string, added, removed []string) {
+		if len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		fmt.Fprintf(&buf, "### %s\n\n", title)
+		for _, item := range added {
+			fmt.Fprintf(&buf, "- Added %s\n", item)
+		}
+		for _, item := range removed {
+			fmt.Fprintf(&buf, "- Removed %s\n", item)
+		}
+		buf.WriteByte('\n')
+	}
+	writeList("Authors", d.AuthorsAdded, d.AuthorsRemoved)
+	writeList("Contributors", d.ContributorsAdded, d.ContributorsRemoved)
+
+	if len(d.Dependencies) > 0 {
+		buf.WriteString("### Dependencies\n\n")
+		buf.WriteString("| Environment | Dependency | Change | Old | New |\n")
+		buf.WriteString("|---|---|---|---|---|\n")
+		for _, dep := range d.Dependencies {
+			fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s |\n",
+				environmentLabel(dep.Environment), markdownCell(dep.Name),
+				dep.Kind, markdownCell(dep.Old), markdownCell(dep.New))
+		}
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// WriteJSON writes the diff to the writer as json.
+func (d *PackDiff) WriteJSON(writer io.Writer) error {
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// packField is a named string representation of a pack's metadata field.
+type packField struct {
+	name  string
+	value string
+}
+
+// packFields flattens the metadata of a pack into comparable strings, the
+// order of the fields is always the same.
+func packFields(p *Pack) []packField {
+	var version string
+	if p.Version != nil {
+		version = p.Version.String()
+	}
+	repo := p.Repository
+	if repo == nil {
+		repo = &Repository{}
+	}
+	support := p.Support
+	if support == nil {
+		support = &Support{}
+	}
+	toolchain := p.Toolchain
+	if toolchain == nil {
+		toolchain = &Toolchain{}
+	}
+	hooks := p.Hooks
+	if hooks == nil {
+		hooks = &Hooks{}
+	}
+
+	return []packField{
+		{"name", p.Name},
+		{"importpath", p.ImportPath},
+		{"version", version},
+		{"summary", p.Summary},
+		{"description", p.Description},
+		{"homepage", p.Homepage},
+		{"repository.type", repo.Type},
+		{"repository.url", repo.URL},
+		{"license", p.License},
+		{"support.website", support.Website},
+		{"support.email", support.Email},
+		{"support.forum", support.Forum},
+		{"support.wiki", support.Wiki},
+		{"support.issues", support.Issues},
+		{"subpackages", strings.Join(p.Subpackages, " ")},
+		{"toolchain.go", toolchain.Go.String()},
+		{"toolchain.tags", strings.Join(toolchain.Tags, " ")},
+		{"toolchain.optionaltags", strings.Join(toolchain.OptionalTags, " ")},
+		{"hooks.preinstall", quoteCommands(hooks.Preinstall)},
+		{"hooks.postinstall", quoteCommands(hooks.Postinstall)},
+		{"hooks.pretest", quoteCommands(hooks.Pretest)},
+		{"hooks.prepublish", quoteCommands(hooks.Prepublish)},
+	}
+}
+
+// extensionFields flattens the extensions of p into comparable strings. The
+// keys of both packs are used so that the fields of p and other line up, a
+// key that p does not have is empty.
+func extensionFields(p, other *Pack) []packField {
+	keys := make(map[string]bool)
+	for key := range p.Extensions {
+		keys[key] = true
+	}
+	for key := range other.Extensions {
+		keys[key] = true
+	}
+
+	var fields []packField
+	for _, key := range sortedKeys(keys) {
+		var value string
+		if ext, ok := p.Extensions[key]; ok {
+			value = fmt.Sprint(ext)
+		}
+		fields = append(fields, packField{"extensions." + key, value})
+	}
+	return fields
+}
+
+// quoteCommands joins hook commands so that the boundaries between them are
+// still visible.
+func quoteCommands(commands []string) string {
+	quoted := make([]string, len(commands))
+	for i, command := range commands {
+		quoted[i] = strconv.Quote(command)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// diffAuthors returns the string forms of the authors that were added and
+// removed between the two lists.
+func diffAuthors(a, b []*Author) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	inA, inB := make(map[string]bool), make(map[string]bool)
+	for _, author := range a {
+		inA[author.String()] = true
+	}
+	for _, author := range b {
+		inB[author.String()] = true
+	}
+	for _, author := range b {
+		if s := author.String(); !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for _, author := range a {
+		if s := author.String(); !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// diffDependencies compares two lists of dependencies by name.
+func diffDependencies(env string, a, b []*Dependency) []*DependencyChange {
+	var changes []*DependencyChange
+	old, cur := make(map[string]string), make(map[string]string)
+	for _, dep := range a {
+		old[dep.Name] = dep.String()
+	}
+	for _, dep := range b {
+		cur[dep.Name] = dep.String()
+	}
+
+	names := make([]string, 0, len(old)+len(cur))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range cur {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		o, inOld := old[name]
+		n, inNew := cur[name]
+		change := &DependencyChange{Environment: env, Name: name, Old: o, New: n}
+		switch {
+		case !inOld:
+			change.Kind = Added
+		case !inNew:
+			change.Kind = Removed
+		case o != n:
+			change.Kind = Changed
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// environmentLabel names an environment for display.
+func environmentLabel(env string) string {
+	if len(env) == 0 {
+		return "dependencies"
+	}
+	return "environments." + env
+}
+
+// quoteEmpty makes an empty value visible in plain text output.
+func quoteEmpty(s string) string {
+	if len(s) == 0 {
+		return `""`
+	}
+	return s
+}
+
+// markdownCell escapes a value so it can be placed in a markdown table.
+func markdownCell(s string) string {
+	if len(s) == 0 {
+		return " "
+	}
+	s = strings.Replace(s, "|", `\|`, -1)
+	return "`" + strings.Replace(s, "\n", " ", -1) + "`"
+}
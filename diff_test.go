@@ -0,0 +1,192 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	. "testing"
+)
+
+func mustParsePack(t *T, str string) *Pack {
+	p, err := ParsePack(bytes.NewBufferString(str))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return p
+}
+
+var testDiffOld = `name: package
+version: 1.0.0
+license: mit
+authors:
+- name: Author1
+- name: Author2
+dependencies:
+- dep >1.2.3
+- gone
+environments:
+  test:
+  - dep4 <1.2.4
+`
+
+var testDiffNew = `name: package
+version: 1.1.0
+license: apache-2.0
+authors:
+- name: Author1
+- name: Author3
+contributors:
+- name: Contrib1
+dependencies:
+- dep >1.3.0
+- new ~2.0.0
+environments:
+  test:
+  - dep4 <1.2.4
+  prod:
+  - dep5
+`
+
+func TestDiffPacks(t *T) {
+	t.Parallel()
+
+	a := mustParsePack(t, testDiffOld)
+	b := mustParsePack(t, testDiffNew)
+	d := DiffPacks(a, b)
+
+	if d.Empty() {
+		t.Fatal("Expected differences.")
+	}
+
+	if ln := len(d.Fields); ln != 2 {
+		t.Error("Expected 2 field changes, got:", ln)
+	} else if f := d.Fields[0]; f.Field != "version" ||
+		f.Old != "1.0.0" || f.New != "1.1.0" {
+		t.Error("Unexpected version change:", f)
+	} else if f = d.Fields[1]; f.Field != "license" {
+		t.Error("Unexpected license change:", f)
+	}
+
+	if ln := len(d.AuthorsAdded); ln != 1 || d.AuthorsAdded[0] != "Author3" {
+		t.Error("Expected Author3 to be added, got:", d.AuthorsAdded)
+	}
+	if ln := len(d.AuthorsRemoved); ln != 1 || d.AuthorsRemoved[0] != "Author2" {
+		t.Error("Expected Author2 to be removed, got:", d.AuthorsRemoved)
+	}
+	if ln := len(d.ContributorsAdded); ln != 1 {
+		t.Error("Expected a contributor to be added, got:", d.ContributorsAdded)
+	}
+
+	var exp = []DependencyChange{
+		{"", "dep", Changed, "dep >1.2.3", "dep >1.3.0"},
+		{"", "gone", Removed, "gone", ""},
+		{"", "new", Added, "", "new ~2.0.0"},
+		{"prod", "dep5", Added, "", "dep5"},
+	}
+	if len(d.Dependencies) != len(exp) {
+		t.Fatal("Expected:", len(exp), "dependency changes, got:",
+			len(d.Dependencies))
+	}
+	for i, change := range d.Dependencies {
+		if *change != exp[i] {
+			t.Errorf("%d) Expected: %v, got: %v", i, exp[i], *change)
+		}
+	}
+}
+
+func TestDiffPacks_Same(t *T) {
+	t.Parallel()
+
+	a := mustParsePack(t, testPack)
+	b := mustParsePack(t, testPack)
+	if d := DiffPacks(a, b); !d.Empty() {
+		t.Error("Expected no differences, got:", d)
+	}
+
+	if d := DiffPacks(nil, nil); !d.Empty() {
+		t.Error("Expected no differences, got:", d)
+	}
+	if d := DiffPacks(nil, a); d.Empty() {
+		t.Error("Expected differences.")
+	}
+}
+
+func TestDiffPacks_HooksExtensions(t *T) {
+	t.Parallel()
+
+	a := mustParsePack(t, `name: package
+hooks:
+  pretest:
+  - go vet ./...
+x-ci: travis
+x-gone: true
+`)
+	b := mustParsePack(t, `name: package
+hooks:
+  pretest:
+  - go vet ./...
+  - go generate
+x-ci: github
+x-new: 5
+`)
+	d := DiffPacks(a, b)
+
+	var exp = []FieldChange{
+		{"hooks.pretest", `"go vet ./..."`,
+			`"go vet ./..." "go generate"`},
+		{"extensions.x-ci", "travis", "github"},
+		{"extensions.x-gone", "true", ""},
+		{"extensions.x-new", "", "5"},
+	}
+	if len(d.Fields) != len(exp) {
+		t.Fatal("Expected:", len(exp), "field changes, got:", d.Fields)
+	}
+	for i, change := range d.Fields {
+		if *change != exp[i] {
+			t.Errorf("%d) Expected: %v, got: %v", i, exp[i], *change)
+		}
+	}
+}
+
+func TestPackDiff_Render(t *T) {
+	t.Parallel()
+
+	d := DiffPacks(mustParsePack(t, testDiffOld), mustParsePack(t, testDiffNew))
+
+	text := d.String()
+	for _, exp := range []string{
+		"~ version: 1.0.0 -> 1.1.0\n",
+		"+ author: Author3\n",
+		"- author: Author2\n",
+		"~ dependencies: dep >1.2.3 -> dep >1.3.0\n",
+		"+ environments.prod: dep5\n",
+	} {
+		if !strings.Contains(text, exp) {
+			t.Errorf("Expected text to contain %q, got:\n%s", exp, text)
+		}
+	}
+
+	md := d.Markdown()
+	for _, exp := range []string{
+		"### Metadata",
+		"| version | `1.0.0` | `1.1.0` |",
+		"- Added Author3",
+		"| dependencies | `new` | added |   | `new ~2.0.0` |",
+	} {
+		if !strings.Contains(md, exp) {
+			t.Errorf("Expected markdown to contain %q, got:\n%s", exp, md)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteJSON(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var decoded PackDiff
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(decoded.Dependencies) != len(d.Dependencies) {
+		t.Error("Expected the json to round trip, got:", buf.String())
+	}
+}
@@ -2,15 +2,35 @@ package pack
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
-	gitTagErr = "fatal: No names found, cannot describe anything.\n"
+	gitTagErr    = "fatal: No names found, cannot describe anything.\n"
+	gitNoTagsErr = "fatal: No tags can describe"
+
+	// VCSGit is the Repository.Type of git repositories.
+	VCSGit = "git"
+	// VCSMercurial is the Repository.Type of mercurial repositories.
+	VCSMercurial = "mercurial"
+	// VCSBazaar is the Repository.Type of bazaar repositories.
+	VCSBazaar = "bazaar"
+	// VCSSubversion is the Repository.Type of subversion repositories.
+	VCSSubversion = "subversion"
+
+	// commandWaitDelay bounds how long to wait for the output of a command
+	// that was killed, in case it left children holding its pipes.
+	commandWaitDelay = time.Second
 )
 
 var (
@@ -37,6 +57,218 @@ type DVCS interface {
 	SetRepoPath(path string)
 }
 
+// ContextDVCS is a DVCS whose commands stop when a context is done. The
+// command is killed when ctx is done, and a command that fails for any
+// reason returns a *CommandError. The methods of DVCS are the same as these
+// with context.Background().
+type ContextDVCS interface {
+	DVCS
+	// StatusContext is Status with a context.
+	StatusContext(ctx context.Context) error
+	// CloneContext is Clone with a context.
+	CloneContext(ctx context.Context, url string) error
+	// UpdateContext is Update with a context.
+	UpdateContext(ctx context.Context) error
+	// CheckoutContext is Checkout with a context.
+	CheckoutContext(ctx context.Context, version string) error
+	// TagsContext is Tags with a context.
+	TagsContext(ctx context.Context) ([]string, error)
+	// CurrentTagContext is CurrentTag with a context.
+	CurrentTagContext(ctx context.Context) (string, error)
+}
+
+// FileReader is implemented by a DVCS that can read a file as it exists at a
+// version without changing the working copy.
+type FileReader interface {
+	// ReadFile reads the file at path, relative to the root of the
+	// repository, as it is at version. If the file does not exist at that
+	// version the error satisfies os.IsNotExist.
+	ReadFile(ctx context.Context, version, path string) ([]byte, error)
+}
+
+// Revisioner is implemented by a DVCS that can identify the exact revision a
+// version refers to.
+type Revisioner interface {
+	// Revision returns the full revision hash of version.
+	Revision(ctx context.Context, version string) (string, error)
+}
+
+// RefStater is implemented by a DVCS that can describe the state of its
+// tags, the state changes whenever a tag is added, moved or removed. The
+// states of the remote and local tags are described the same way, so they
+// are equal when the repository has every tag of its remote. A repository
+// without a remote is its own remote.
+type RefStater interface {
+	// RefState returns an opaque string describing the remote's tags.
+	RefState(ctx context.Context) (string, error)
+	// LocalRefState returns an opaque string describing the tags that Tags
+	// lists.
+	LocalRefState(ctx context.Context) (string, error)
+}
+
+// TagFetcher is implemented by a DVCS that can fetch the tags of its remote
+// without changing the working copy.
+type TagFetcher interface {
+	// FetchTags fetches the remote's tags.
+	FetchTags(ctx context.Context) error
+}
+
+// CommandError is returned when a version control command fails.
+type CommandError struct {
+	// Command is the command line that was run.
+	Command string
+	// Dir is the directory the command was run in, empty for the current
+	// directory.
+	Dir string
+	// ExitCode is the exit code of the command, -1 if it did not exit on its
+	// own because it could not be started or was killed.
+	ExitCode int
+	// Stderr is what the command wrote to stderr.
+	Stderr string
+	// Err is the underlying error, ctx.Err() when the command was killed
+	// because its context was done.
+	Err error
+}
+
+// Error implements the error interface.
+func (c *CommandError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "pack: %s", c.Command)
+	if len(c.Dir) > 0 {
+		fmt.Fprintf(&buf, " (in %s)", c.Dir)
+	}
+	fmt.Fprintf(&buf, ": %v", c.Err)
+	if stderr := strings.TrimSpace(c.Stderr); len(stderr) > 0 {
+		fmt.Fprintf(&buf, ": %s", stderr)
+	}
+	return buf.String()
+}
+
+// Unwrap returns the underlying error.
+func (c *CommandError) Unwrap() error {
+	return c.Err
+}
+
+// withContext returns dvcs as a ContextDVCS. A DVCS that does not implement
+// ContextDVCS doesn't start a command once ctx is done, but a command that
+// has started runs to completion.
+func withContext(dvcs DVCS) ContextDVCS {
+	if c, ok := dvcs.(ContextDVCS); ok {
+		return c
+	}
+	return backgroundDVCS{dvcs}
+}
+
+// backgroundDVCS adapts a DVCS without context support to ContextDVCS.
+type backgroundDVCS struct {
+	DVCS
+}
+
+// StatusContext is Status with a context.
+func (b backgroundDVCS) StatusContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Status()
+}
+
+// CloneContext is Clone with a context.
+func (b backgroundDVCS) CloneContext(ctx context.Context, url string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Clone(url)
+}
+
+// UpdateContext is Update with a context.
+func (b backgroundDVCS) UpdateContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Update()
+}
+
+// CheckoutContext is Checkout with a context.
+func (b backgroundDVCS) CheckoutContext(ctx context.Context,
+	version string) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Checkout(version)
+}
+
+// TagsContext is Tags with a context.
+func (b backgroundDVCS) TagsContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.Tags()
+}
+
+// CurrentTagContext is CurrentTag with a context.
+func (b backgroundDVCS) CurrentTagContext(ctx context.Context) (string,
+	error) {
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return b.CurrentTag()
+}
+
+// NewDVCS creates the DVCS for a Repository.Type with its repository at dir.
+func NewDVCS(vcs, dir string) (DVCS, error) {
+	switch vcs {
+	case VCSGit:
+		return NewGit(dir), nil
+	case VCSMercurial:
+		return NewHg(dir), nil
+	case VCSBazaar:
+		return NewBzr(dir), nil
+	case VCSSubversion:
+		return NewSvn(dir), nil
+	}
+	return nil, fmt.Errorf(`pack: Unknown repository type "%s".`, vcs)
+}
+
+// DVCSType returns the Repository.Type of a DVCS.
+func DVCSType(dvcs DVCS) string {
+	switch dvcs.(type) {
+	case *Git:
+		return VCSGit
+	case *Hg:
+		return VCSMercurial
+	case *Bzr:
+		return VCSBazaar
+	case *Svn:
+		return VCSSubversion
+	}
+	return ""
+}
+
+// DetectDVCS returns the DVCS for the repository whose root is dir, based on
+// which metadata directory it contains.
+func DetectDVCS(dir string) (DVCS, error) {
+	var detect = []struct {
+		metadata string
+		create   func(string) DVCS
+	}{
+		{".git", NewGit},
+		{".hg", NewHg},
+		{".bzr", NewBzr},
+		{".svn", NewSvn},
+	}
+	for _, d := range detect {
+		exists, err := DirExists(filepath.Join(dir, d.metadata))
+		if err != nil {
+			return nil, err
+		} else if exists {
+			return d.create(dir), nil
+		}
+	}
+	return nil, fmt.Errorf(`pack: No repository found at "%s".`, dir)
+}
+
 // dvcsHelper provides various helper functions for the dvcs implementations.
 type dvcsHelper struct {
 	// Repository is the location of the repository.
@@ -48,32 +280,52 @@ func (d *dvcsHelper) SetRepoPath(path string) {
 	d.Repository = path
 }
 
-// getCmdOutput wraps all the crazy error handling required to get input
-// from a command.
-func (_ dvcsHelper) getCmdOutput(cmd *exec.Cmd) ([]byte, []byte, error) {
-	var stdout, stderr []byte
-	var stdoutPipe, stderrPipe io.ReadCloser
-	var err error
-	if stdoutPipe, err = cmd.StdoutPipe(); err != nil {
-		return nil, nil, err
-	}
-	if stderrPipe, err = cmd.StderrPipe(); err != nil {
-		return nil, nil, err
-	}
-	if err = cmd.Start(); err != nil {
-		return nil, nil, err
-	}
-	if stdout, err = ioutil.ReadAll(stdoutPipe); err != nil {
-		return stdout, stderr, nil
+// run runs a command in the repository and captures its output.
+func (d dvcsHelper) run(ctx context.Context, name string, args ...string) (
+	[]byte, []byte, error) {
+
+	return runCommand(ctx, d.Repository, name, args...)
+}
+
+// runCommand runs a command in dir, or the current directory if it is empty,
+// and captures its output. If the command fails the error is a
+// *CommandError, the output is returned either way.
+func runCommand(ctx context.Context, dir, name string, args ...string) (
+	[]byte, []byte, error) {
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	return captureCommand(ctx, cmd)
+}
+
+// captureCommand runs cmd, which was created with ctx, and captures its
+// output as described by runCommand.
+func captureCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, []byte,
+	error) {
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = commandWaitDelay
+
+	err := cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), stderr.Bytes(), nil
 	}
-	if stderr, err = ioutil.ReadAll(stderrPipe); err != nil {
-		return stdout, stderr, nil
+
+	cmdErr := &CommandError{
+		Command:  strings.Join(cmd.Args, " "),
+		Dir:      cmd.Dir,
+		ExitCode: -1,
+		Stderr:   stderr.String(),
+		Err:      err,
 	}
-	if err = cmd.Wait(); err != nil {
-		return stdout, stderr, nil
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		cmdErr.Err = ctxErr
+	} else if exit, ok := err.(*exec.ExitError); ok {
+		cmdErr.ExitCode = exit.ExitCode()
 	}
-
-	return stdout, stderr, nil
+	return stdout.Bytes(), stderr.Bytes(), cmdErr
 }
 
 // Git uses the git toolset to implement the dvcs interface.
@@ -106,6 +358,22 @@ func NewBzr(repo string) DVCS {
 	return &Bzr{dvcsHelper{repo}}
 }
 
+// Svn uses the subversion toolset to implement the dvcs interface. The
+// repository must have the conventional layout, trunk is checked out by Clone
+// and each directory in tags is a tag. Repository is the working copy.
+//
+// A version is a tag name, a revision number of trunk, or a path in the
+// repository at a peg revision such as tags/1.0.0@3, which is the form
+// Revision returns.
+type Svn struct {
+	dvcsHelper
+}
+
+// NewSvn returns a new instance of the svn dvcs.
+func NewSvn(repo string) DVCS {
+	return &Svn{dvcsHelper{repo}}
+}
+
 // repoExists checks to see if a repo exists, returns an error if it does not.
 func (d dvcsHelper) repoExists() error {
 	if exists, err := DirExists(d.Repository); err != nil {
@@ -119,56 +387,76 @@ func (d dvcsHelper) repoExists() error {
 // Status performs a status check on the repository to see if it's actually
 // a git repository.
 func (g *Git) Status() error {
+	return g.StatusContext(context.Background())
+}
+
+// StatusContext is Status with a context.
+func (g *Git) StatusContext(ctx context.Context) error {
 	if err := g.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("git", "status")
-	cmd.Dir = g.Repository
-	return cmd.Run()
+	_, _, err := g.run(ctx, "git", "status")
+	return err
 }
 
 // Clone downloads a repository if it doesn't exist on disk.
 func (g *Git) Clone(url string) error {
+	return g.CloneContext(context.Background(), url)
+}
+
+// CloneContext is Clone with a context.
+func (g *Git) CloneContext(ctx context.Context, url string) error {
 	if err := g.repoExists(); err == nil {
 		return nil
 	}
 
-	cmd := exec.Command("git", "clone", url, g.Repository)
-	return cmd.Run()
+	_, _, err := runCommand(ctx, "", "git", "clone", url, g.Repository)
+	return err
 }
 
 // Update updates a repository from the default remote.
 func (g *Git) Update() error {
+	return g.UpdateContext(context.Background())
+}
+
+// UpdateContext is Update with a context.
+func (g *Git) UpdateContext(ctx context.Context) error {
 	if err := g.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("git", "fetch")
-	cmd.Dir = g.Repository
-	return cmd.Run()
+	_, _, err := g.run(ctx, "git", "fetch")
+	return err
 }
 
 // Checkout checks out a version of the repository.
 func (g *Git) Checkout(version string) error {
+	return g.CheckoutContext(context.Background(), version)
+}
+
+// CheckoutContext is Checkout with a context.
+func (g *Git) CheckoutContext(ctx context.Context, version string) error {
 	if err := g.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("git", "checkout", version)
-	cmd.Dir = g.Repository
-	return cmd.Run()
+	_, _, err := g.run(ctx, "git", "checkout", version)
+	return err
 }
 
 // Tags gets the list of all tags for the repository.
 func (g *Git) Tags() ([]string, error) {
+	return g.TagsContext(context.Background())
+}
+
+// TagsContext is Tags with a context.
+func (g *Git) TagsContext(ctx context.Context) ([]string, error) {
 	if err := g.repoExists(); err != nil {
 		return nil, err
 	}
 
-	cmd := exec.Command("git", "tag", "-l")
-	cmd.Dir = g.Repository
-	stdout, _, err := g.getCmdOutput(cmd)
+	stdout, _, err := g.run(ctx, "git", "tag", "-l")
 	if err != nil {
 		return nil, err
 	}
@@ -193,16 +481,23 @@ func (g *Git) Tags() ([]string, error) {
 // CurrentTag retrieves the current tag of the repository, or empty string if
 // no tag exists.
 func (g *Git) CurrentTag() (string, error) {
+	return g.CurrentTagContext(context.Background())
+}
+
+// CurrentTagContext is CurrentTag with a context.
+func (g *Git) CurrentTagContext(ctx context.Context) (string, error) {
 	var tag string
 	if err := g.repoExists(); err != nil {
 		return tag, err
 	}
 
-	cmd := exec.Command("git", "describe", "--tags")
-	cmd.Dir = g.Repository
-	stdout, stderr, err := g.getCmdOutput(cmd)
+	stdout, stderr, err := g.run(ctx, "git", "describe", "--tags")
 	if err != nil {
-		if stderr != nil && string(stderr) == gitTagErr {
+		// Without tags, or without one that HEAD descends from, there is
+		// no current tag.
+		if string(stderr) == gitTagErr ||
+			bytes.HasPrefix(stderr, []byte(gitNoTagsErr)) {
+
 			return tag, nil
 		}
 		return tag, err
@@ -215,59 +510,180 @@ func (g *Git) CurrentTag() (string, error) {
 	return string(bytes.TrimSpace(stdout)), nil
 }
 
+// ReadFile reads a file as it exists at version without changing the working
+// copy.
+func (g *Git) ReadFile(ctx context.Context, version, path string) ([]byte,
+	error) {
+
+	if err := g.repoExists(); err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := g.run(ctx, "git", "show",
+		version+":"+filepath.ToSlash(path))
+	if bytes.Contains(stderr, []byte("does not exist")) ||
+		bytes.Contains(stderr, []byte("exists on disk, but not in")) {
+
+		return nil, &os.PathError{Op: "show", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout, nil
+}
+
+// Revision returns the commit hash that version refers to.
+func (g *Git) Revision(ctx context.Context, version string) (string, error) {
+	if err := g.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := g.run(ctx, "git", "rev-parse", "--verify",
+		version+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(stdout)), nil
+}
+
+// RefState hashes the remote's tags and the revisions they point to.
+func (g *Git) RefState(ctx context.Context) (string, error) {
+	if err := g.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, stderr, err := g.run(ctx, "git", "ls-remote", "--tags")
+	if err != nil && bytes.Contains(stderr, []byte("No remote configured")) {
+		return g.LocalRefState(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hashRefs(stdout), nil
+}
+
+// LocalRefState hashes the local tags and the revisions they point to.
+func (g *Git) LocalRefState(ctx context.Context) (string, error) {
+	if err := g.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := g.run(ctx, "git", "show-ref", "--tags", "--dereference")
+	if cmdErr, ok := err.(*CommandError); ok && cmdErr.ExitCode == 1 &&
+		len(stdout) == 0 {
+
+		// show-ref fails when there are no tags at all.
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return hashRefs(stdout), nil
+}
+
+// FetchTags fetches the tags of the default remote. Tags that were deleted
+// from the remote are kept.
+func (g *Git) FetchTags(ctx context.Context) error {
+	if err := g.repoExists(); err != nil {
+		return err
+	}
+
+	_, _, err := g.run(ctx, "git", "fetch", "--tags")
+	return err
+}
+
+// hashRefs hashes a listing of revisions and refs, one pair per line, so
+// that ls-remote and show-ref listings of the same refs hash the same.
+func hashRefs(listing []byte) string {
+	var refs []string
+	for _, line := range strings.Split(string(listing), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs = append(refs, fields[0]+" "+fields[1])
+		}
+	}
+	sort.Strings(refs)
+	return hashState([]byte(strings.Join(refs, "\n")))
+}
+
+// hashState hashes the output of a command into an opaque ref state.
+func hashState(output []byte) string {
+	sum := sha256.Sum256(output)
+	return hex.EncodeToString(sum[:])
+}
+
 // Status performs a status check on the repository to see if it's actually
 // an hg repository.
 func (h *Hg) Status() error {
+	return h.StatusContext(context.Background())
+}
+
+// StatusContext is Status with a context.
+func (h *Hg) StatusContext(ctx context.Context) error {
 	if err := h.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("hg", "status")
-	cmd.Dir = h.Repository
-	return cmd.Run()
+	_, _, err := h.run(ctx, "hg", "status")
+	return err
 }
 
 // Clone downloads a repository if it doesn't exist on disk.
 func (h *Hg) Clone(url string) error {
+	return h.CloneContext(context.Background(), url)
+}
+
+// CloneContext is Clone with a context.
+func (h *Hg) CloneContext(ctx context.Context, url string) error {
 	if err := h.repoExists(); err == nil {
 		return nil
 	}
 
-	cmd := exec.Command("hg", "clone", url, h.Repository)
-	return cmd.Run()
+	_, _, err := runCommand(ctx, "", "hg", "clone", url, h.Repository)
+	return err
 }
 
 // Update updates a repository from the default remote.
 func (h *Hg) Update() error {
+	return h.UpdateContext(context.Background())
+}
+
+// UpdateContext is Update with a context.
+func (h *Hg) UpdateContext(ctx context.Context) error {
 	if err := h.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("hg", "pull")
-	cmd.Dir = h.Repository
-	return cmd.Run()
+	_, _, err := h.run(ctx, "hg", "pull")
+	return err
 }
 
 // Checkout checks out a version of the repository.
 func (h *Hg) Checkout(version string) error {
+	return h.CheckoutContext(context.Background(), version)
+}
+
+// CheckoutContext is Checkout with a context.
+func (h *Hg) CheckoutContext(ctx context.Context, version string) error {
 	if err := h.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("hg", "checkout", version)
-	cmd.Dir = h.Repository
-	return cmd.Run()
+	_, _, err := h.run(ctx, "hg", "checkout", version)
+	return err
 }
 
 // Tags gets the list of all tags for the repository.
 func (h *Hg) Tags() ([]string, error) {
+	return h.TagsContext(context.Background())
+}
+
+// TagsContext is Tags with a context.
+func (h *Hg) TagsContext(ctx context.Context) ([]string, error) {
 	if err := h.repoExists(); err != nil {
 		return nil, err
 	}
 
-	cmd := exec.Command("hg", "tags")
-	cmd.Dir = h.Repository
-	stdout, _, err := h.getCmdOutput(cmd)
+	stdout, _, err := h.run(ctx, "hg", "tags")
 	if err != nil {
 		return nil, err
 	}
@@ -293,14 +709,17 @@ func (h *Hg) Tags() ([]string, error) {
 // CurrentTag retrieves the current tag of the repository, or empty string if
 // no tag exists.
 func (h *Hg) CurrentTag() (string, error) {
+	return h.CurrentTagContext(context.Background())
+}
+
+// CurrentTagContext is CurrentTag with a context.
+func (h *Hg) CurrentTagContext(ctx context.Context) (string, error) {
 	var tag string
 	if err := h.repoExists(); err != nil {
 		return tag, err
 	}
 
-	cmd := exec.Command("hg", "identify")
-	cmd.Dir = h.Repository
-	stdout, _, err := h.getCmdOutput(cmd)
+	stdout, _, err := h.run(ctx, "hg", "identify")
 	if err != nil {
 		return tag, err
 	}
@@ -328,60 +747,539 @@ func (h *Hg) CurrentTag() (string, error) {
 	return tag, nil
 }
 
+// ReadFile reads a file as it exists at version without changing the working
+// copy.
+func (h *Hg) ReadFile(ctx context.Context, version, path string) ([]byte,
+	error) {
+
+	if err := h.repoExists(); err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := h.run(ctx, "hg", "cat", "-r", version,
+		filepath.ToSlash(path))
+	if bytes.Contains(stderr, []byte("no such file in rev")) {
+		return nil, &os.PathError{Op: "cat", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout, nil
+}
+
+// Revision returns the changeset hash that version refers to.
+func (h *Hg) Revision(ctx context.Context, version string) (string, error) {
+	if err := h.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := h.run(ctx, "hg", "log", "-r", version, "--template",
+		"{node}")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(stdout)), nil
+}
+
+// RefState hashes the tip of the default remote. Tags are commits to the
+// .hgtags file so any change to them changes the tip.
+func (h *Hg) RefState(ctx context.Context) (string, error) {
+	if err := h.repoExists(); err != nil {
+		return "", err
+	}
+
+	_, _, err := h.run(ctx, "hg", "paths", "default")
+	if cmdErr, ok := err.(*CommandError); ok && cmdErr.ExitCode == 1 {
+		// There is no default remote.
+		return h.LocalRefState(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	stdout, _, err := h.run(ctx, "hg", "identify", "--debug", "--id", "-r",
+		"tip", "default")
+	if err != nil {
+		return "", err
+	}
+	return hashState(bytes.TrimSpace(stdout)), nil
+}
+
+// LocalRefState hashes the tip of the repository.
+func (h *Hg) LocalRefState(ctx context.Context) (string, error) {
+	if err := h.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := h.run(ctx, "hg", "identify", "--debug", "--id", "-r",
+		"tip")
+	if err != nil {
+		return "", err
+	}
+	return hashState(bytes.TrimSpace(stdout)), nil
+}
+
+// FetchTags pulls from the default remote, which doesn't update the working
+// copy.
+func (h *Hg) FetchTags(ctx context.Context) error {
+	return h.UpdateContext(ctx)
+}
+
 // Status performs a status check on the repository to see if it's actually
 // a bzr repository.
 func (b *Bzr) Status() error {
+	return b.StatusContext(context.Background())
+}
+
+// StatusContext is Status with a context.
+func (b *Bzr) StatusContext(ctx context.Context) error {
 	if err := b.repoExists(); err != nil {
 		return err
 	}
 
-	cmd := exec.Command("bzr", "status")
-	return cmd.Run()
+	_, _, err := b.run(ctx, "bzr", "status")
+	return err
 }
 
 // Clone downloads a repository if it doesn't exist on disk.
 func (b *Bzr) Clone(url string) error {
+	return b.CloneContext(context.Background(), url)
+}
+
+// CloneContext is Clone with a context.
+func (b *Bzr) CloneContext(ctx context.Context, url string) error {
 	if err := b.repoExists(); err == nil {
 		return nil
 	}
 
-	return fmt.Errorf("Not implemented yet!")
+	_, _, err := runCommand(ctx, "", "bzr", "branch", url, b.Repository)
+	return err
 }
 
-// Update updates a repository from the default remote.
+// Update updates a repository from the parent branch.
 func (b *Bzr) Update() error {
+	return b.UpdateContext(context.Background())
+}
+
+// UpdateContext is Update with a context.
+func (b *Bzr) UpdateContext(ctx context.Context) error {
 	if err := b.repoExists(); err != nil {
 		return err
 	}
 
-	return fmt.Errorf("Not implemented yet!")
+	_, _, err := b.run(ctx, "bzr", "pull")
+	return err
 }
 
-// Checkout checks out a version of the repository.
+// Checkout checks out a version of the repository, either a tag or a
+// revision id as returned by Revision.
 func (b *Bzr) Checkout(version string) error {
+	return b.CheckoutContext(context.Background(), version)
+}
+
+// CheckoutContext is Checkout with a context.
+func (b *Bzr) CheckoutContext(ctx context.Context, version string) error {
 	if err := b.repoExists(); err != nil {
 		return err
 	}
 
-	return fmt.Errorf("Not implemented yet!")
+	_, _, err := b.run(ctx, "bzr", "update", "-r", bzrRevision(version))
+	return err
 }
 
 // Tags gets the list of all tags for the repository.
 func (b *Bzr) Tags() ([]string, error) {
+	return b.TagsContext(context.Background())
+}
+
+// TagsContext is Tags with a context.
+func (b *Bzr) TagsContext(ctx context.Context) ([]string, error) {
 	if err := b.repoExists(); err != nil {
 		return nil, err
 	}
 
-	return nil, fmt.Errorf("Not implemented yet!")
+	revnos, err := b.tagRevnos(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revnos) == 0 {
+		return nil, nil
+	}
+
+	tags := make([]string, 0, len(revnos))
+	for _, tr := range revnos {
+		tags = append(tags, tr[0])
+	}
+	return tags, nil
 }
 
 // CurrentTag retrieves the current tag of the repository, or empty string if
 // no tag exists.
 func (b *Bzr) CurrentTag() (string, error) {
+	return b.CurrentTagContext(context.Background())
+}
+
+// CurrentTagContext is CurrentTag with a context.
+func (b *Bzr) CurrentTagContext(ctx context.Context) (string, error) {
 	var tag string
 	if err := b.repoExists(); err != nil {
 		return tag, err
 	}
 
-	return "", fmt.Errorf("Not implemented yet!")
+	stdout, _, err := b.run(ctx, "bzr", "version-info", "--custom",
+		"--template={revno}")
+	if err != nil {
+		return tag, err
+	}
+
+	revno := string(bytes.TrimSpace(stdout))
+	if len(revno) == 0 {
+		return tag, nil
+	}
+
+	revnos, err := b.tagRevnos(ctx)
+	if err != nil {
+		return tag, err
+	}
+
+	for _, tr := range revnos {
+		if tr[1] == revno {
+			tag = tr[0]
+			break
+		}
+	}
+
+	return tag, nil
+}
+
+// ReadFile reads a file as it exists at version without changing the working
+// copy.
+func (b *Bzr) ReadFile(ctx context.Context, version, path string) ([]byte,
+	error) {
+
+	if err := b.repoExists(); err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := b.run(ctx, "bzr", "cat", "-r",
+		bzrRevision(version), filepath.ToSlash(path))
+	if bytes.Contains(stderr, []byte("is not present in revision")) {
+		return nil, &os.PathError{Op: "cat", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout, nil
+}
+
+// Revision returns the revision id that version refers to.
+func (b *Bzr) Revision(ctx context.Context, version string) (string, error) {
+	if err := b.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := b.run(ctx, "bzr", "revision-info", "-r",
+		bzrRevision(version))
+	if err != nil {
+		return "", err
+	}
+	fields := bytes.Fields(stdout)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("pack: Unexpected bzr revision-info output %q.",
+			stdout)
+	}
+	return string(fields[1]), nil
+}
+
+// RefState hashes the tags of the parent branch and the revision ids they
+// point to.
+func (b *Bzr) RefState(ctx context.Context) (string, error) {
+	if err := b.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, stderr, err := b.run(ctx, "bzr", "tags", "--show-ids", "-d",
+		":parent")
+	if err != nil && bytes.Contains(stderr, []byte("No parent location")) {
+		return b.LocalRefState(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hashState(stdout), nil
+}
+
+// LocalRefState hashes the tags of the branch and the revision ids they
+// point to.
+func (b *Bzr) LocalRefState(ctx context.Context) (string, error) {
+	if err := b.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := b.run(ctx, "bzr", "tags", "--show-ids")
+	if err != nil {
+		return "", err
+	}
+	return hashState(stdout), nil
+}
+
+// bzrRevision is the revision specifier of a version, a tag if it's a
+// version number and otherwise a revision id.
+func bzrRevision(version string) string {
+	if rgxVersion.MatchString(version) {
+		return "tag:" + version
+	}
+	return "revid:" + version
+}
+
+// tagRevnos lists the version tags of the repository along with the revno
+// each one points to.
+func (b *Bzr) tagRevnos(ctx context.Context) ([][2]string, error) {
+	stdout, _, err := b.run(ctx, "bzr", "tags")
+	if err != nil {
+		return nil, err
+	}
+
+	var revnos [][2]string
+	lines := bytes.Split(stdout, []byte{'\n'})
+	for i := 0; i < len(lines); i++ {
+		fields := bytes.Fields(lines[i])
+		if len(fields) < 2 {
+			continue
+		}
+		if rgxVersion.Match(fields[0]) {
+			revnos = append(revnos, [2]string{
+				string(fields[0]), string(fields[1]),
+			})
+		}
+	}
+	return revnos, nil
+}
+
+// Status performs a status check on the repository to see if it's actually
+// an svn working copy.
+func (s *Svn) Status() error {
+	return s.StatusContext(context.Background())
+}
+
+// StatusContext is Status with a context.
+func (s *Svn) StatusContext(ctx context.Context) error {
+	if err := s.repoExists(); err != nil {
+		return err
+	}
+
+	_, _, err := s.run(ctx, "svn", "status", "--non-interactive")
+	return err
+}
+
+// Clone checks out the trunk of a repository if it doesn't exist on disk.
+func (s *Svn) Clone(url string) error {
+	return s.CloneContext(context.Background(), url)
+}
+
+// CloneContext is Clone with a context.
+func (s *Svn) CloneContext(ctx context.Context, url string) error {
+	if err := s.repoExists(); err == nil {
+		return nil
+	}
+
+	_, _, err := runCommand(ctx, "", "svn", "checkout", "--non-interactive",
+		strings.TrimSuffix(url, "/")+"/trunk", s.Repository)
+	return err
+}
+
+// Update updates the working copy to the latest revision.
+func (s *Svn) Update() error {
+	return s.UpdateContext(context.Background())
+}
+
+// UpdateContext is Update with a context.
+func (s *Svn) UpdateContext(ctx context.Context) error {
+	if err := s.repoExists(); err != nil {
+		return err
+	}
+
+	_, _, err := s.run(ctx, "svn", "update", "--non-interactive")
+	return err
+}
+
+// Checkout switches the working copy to a version.
+func (s *Svn) Checkout(version string) error {
+	return s.CheckoutContext(context.Background(), version)
+}
+
+// CheckoutContext is Checkout with a context.
+func (s *Svn) CheckoutContext(ctx context.Context, version string) error {
+	if err := s.repoExists(); err != nil {
+		return err
+	}
+
+	_, _, err := s.run(ctx, "svn", "switch", "--non-interactive",
+		svnURL(version, ""))
+	return err
+}
+
+// Tags gets the list of all tags for the repository.
+func (s *Svn) Tags() ([]string, error) {
+	return s.TagsContext(context.Background())
+}
+
+// TagsContext is Tags with a context.
+func (s *Svn) TagsContext(ctx context.Context) ([]string, error) {
+	if err := s.repoExists(); err != nil {
+		return nil, err
+	}
+
+	stdout, _, err := s.run(ctx, "svn", "list", "--non-interactive",
+		"^/tags")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stdout) == 0 {
+		return nil, nil
+	}
+
+	tags := make([]string, 0)
+	tagBytes := bytes.Split(stdout, []byte{'\n'})
+	for i := 0; i < len(tagBytes); i++ {
+		tagByte := bytes.TrimRight(bytes.TrimSpace(tagBytes[i]), "/")
+		if len(tagByte) == 0 {
+			continue
+		}
+		if rgxVersion.Match(tagByte) {
+			tags = append(tags, string(tagByte))
+		}
+	}
+	return tags, nil
+}
+
+// CurrentTag retrieves the tag the working copy is switched to, or empty
+// string if it is not on a tag.
+func (s *Svn) CurrentTag() (string, error) {
+	return s.CurrentTagContext(context.Background())
+}
+
+// CurrentTagContext is CurrentTag with a context.
+func (s *Svn) CurrentTagContext(ctx context.Context) (string, error) {
+	var tag string
+	if err := s.repoExists(); err != nil {
+		return tag, err
+	}
+
+	stdout, _, err := s.run(ctx, "svn", "info", "--non-interactive")
+	if err != nil {
+		return tag, err
+	}
+
+	var url, root string
+	lines := bytes.Split(stdout, []byte{'\n'})
+	for i := 0; i < len(lines); i++ {
+		line := string(bytes.TrimSpace(lines[i]))
+		if strings.HasPrefix(line, "URL: ") {
+			url = strings.TrimPrefix(line, "URL: ")
+		} else if strings.HasPrefix(line, "Repository Root: ") {
+			root = strings.TrimPrefix(line, "Repository Root: ")
+		}
+	}
+	if len(url) == 0 || len(root) == 0 || !strings.HasPrefix(url, root) {
+		return tag, nil
+	}
+
+	parts := strings.Split(strings.Trim(url[len(root):], "/"), "/")
+	if len(parts) == 2 && parts[0] == "tags" &&
+		rgxVersion.MatchString(parts[1]) {
+
+		tag = parts[1]
+	}
+
+	return tag, nil
+}
+
+// ReadFile reads a file as it exists in a tag, or in trunk at a revision,
+// without changing the working copy.
+func (s *Svn) ReadFile(ctx context.Context, version, path string) ([]byte,
+	error) {
+
+	if err := s.repoExists(); err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := s.run(ctx, "svn", "cat", "--non-interactive",
+		svnURL(version, path))
+	if bytes.Contains(stderr, []byte("W160013")) ||
+		bytes.Contains(stderr, []byte("E200009")) {
+
+		return nil, &os.PathError{Op: "cat", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout, nil
+}
+
+// Revision returns the path of version pegged at its revision. A tag is
+// pegged at the revision it was last changed in, so the revision refers to
+// the tag's tree whichever revision of trunk it was copied from.
+func (s *Svn) Revision(ctx context.Context, version string) (string, error) {
+	if err := s.repoExists(); err != nil {
+		return "", err
+	}
+
+	loc, rev := svnLocation(version)
+	item := "revision"
+	if len(rev) == 0 {
+		item = "last-changed-revision"
+	}
+	stdout, _, err := s.run(ctx, "svn", "info", "--non-interactive",
+		"--show-item", item, svnURL(version, ""))
+	if err != nil {
+		return "", err
+	}
+	return loc + "@" + string(bytes.TrimSpace(stdout)), nil
+}
+
+// svnLocation splits a version into its path in the repository and its peg
+// revision, which is empty for the latest revision of a tag.
+func svnLocation(version string) (loc, rev string) {
+	if rgxVersion.MatchString(version) {
+		return "tags/" + version, ""
+	}
+	if i := strings.LastIndex(version, "@"); i >= 0 {
+		return version[:i], version[i+1:]
+	}
+	return "trunk", version
+}
+
+// svnURL is the repository relative url of a path in the tree of a version.
+func svnURL(version, path string) string {
+	loc, rev := svnLocation(version)
+	url := "^/" + loc
+	if len(path) > 0 {
+		url += "/" + filepath.ToSlash(path)
+	}
+	if len(rev) > 0 {
+		url += "@" + rev
+	}
+	return url
+}
+
+// RefState hashes the listing of the tags directory, which has the revision
+// each tag was last changed in.
+func (s *Svn) RefState(ctx context.Context) (string, error) {
+	if err := s.repoExists(); err != nil {
+		return "", err
+	}
+
+	stdout, _, err := s.run(ctx, "svn", "list", "--non-interactive", "-v",
+		"^/tags")
+	if err != nil {
+		return "", err
+	}
+	return hashState(stdout), nil
+}
+
+// LocalRefState is RefState, the tags are always listed from the server.
+func (s *Svn) LocalRefState(ctx context.Context) (string, error) {
+	return s.RefState(ctx)
 }
@@ -2,10 +2,16 @@ package pack
 
 import (
 	"archive/zip"
+	"context"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	. "testing"
+	"time"
 )
 
 // unzipArchive is here to ease porting to windows later. (Instead of just exec
@@ -128,13 +134,394 @@ func TestHg(t *T) {
 }
 
 func TestBzr(t *T) {
-	// When this becomes an actual issue, deal with it.
-	t.Log("Is bzr actually a dvcs?")
-	t.SkipNow()
-
 	if Short() {
 		t.SkipNow()
 	}
+	if _, err := exec.LookPath("bzr"); err != nil {
+		t.Skip("bzr is not installed.")
+	}
 
 	testDvcsHelper(t, "testbzr.zip", &Bzr{})
 }
+
+func TestBzr_Metadata(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("bzr"); err != nil {
+		t.Skip("bzr is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopackbzr")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = unzipArchive("testbzr.zip", dir); err != nil {
+		t.Fatal("Failed to unzip dvcs archive:", err)
+	}
+
+	ctx := context.Background()
+	bzr := NewBzr(dir).(*Bzr)
+
+	read, err := bzr.ReadFile(ctx, "0.0.2", "README.txt")
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	} else if string(read) != "Changed text file.\n" {
+		t.Errorf("Unexpected contents: %q", read)
+	}
+	if _, err = bzr.ReadFile(ctx, "0.0.1", PACKFILE); !os.IsNotExist(err) {
+		t.Error("Expected a not exist error, got:", err)
+	}
+
+	const first = "test@test.com-20131011084356-zfademdcij33q9xq"
+	revision, err := bzr.Revision(ctx, "0.0.1")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if revision != first {
+		t.Error("Unexpected revision:", revision)
+	}
+	if err = bzr.Checkout(revision); err != nil {
+		t.Error("Failed to checkout revision:", err)
+	}
+	if tag, err := bzr.CurrentTag(); err != nil || tag != "0.0.1" {
+		t.Error("Expected the revision's tag, got:", tag, err)
+	}
+
+	state, err := bzr.RefState(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if same, _ := bzr.RefState(ctx); same != state || len(state) == 0 {
+		t.Error("Expected the same ref state, got:", same)
+	}
+	cmd := exec.Command("bzr", "tag", "-r", "revid:"+first, "0.0.3")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, out)
+	}
+	if changed, _ := bzr.RefState(ctx); changed == state {
+		t.Error("Expected a new tag to change the ref state.")
+	}
+}
+
+func TestCommandError(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopackcmd")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	gitTestRepo(t, dir)
+
+	git := NewGit(dir).(ContextDVCS)
+	err = git.CheckoutContext(context.Background(), "9.9.9")
+	cmdErr, ok := err.(*CommandError)
+	if !ok {
+		t.Fatal("Expected a command error, got:", err)
+	}
+	if cmdErr.Command != "git checkout 9.9.9" {
+		t.Error("Unexpected command:", cmdErr.Command)
+	}
+	if cmdErr.Dir != dir {
+		t.Error("Unexpected dir:", cmdErr.Dir)
+	}
+	if cmdErr.ExitCode <= 0 {
+		t.Error("Expected a failing exit code, got:", cmdErr.ExitCode)
+	}
+	if len(cmdErr.Stderr) == 0 {
+		t.Error("Expected stderr to be captured.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	clone := NewGit(filepath.Join(dir, "clone")).(ContextDVCS)
+	err = clone.CloneContext(ctx, dir)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("Expected the clone to be canceled, got:", err)
+	}
+}
+
+func TestRunCommand_Timeout(t *T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep is not available.")
+	}
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not installed.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := runCommand(ctx, "", "sleep", "5")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("Expected the command to be killed, took:", elapsed)
+	}
+	cmdErr, ok := err.(*CommandError)
+	if !ok {
+		t.Fatal("Expected a command error, got:", err)
+	}
+	if cmdErr.Err != context.DeadlineExceeded || cmdErr.ExitCode != -1 {
+		t.Error("Unexpected command error:", cmdErr.Err, cmdErr.ExitCode)
+	}
+}
+
+// svnTestRepo creates a subversion repository in dir with trunk and tags. The
+// tag 1.0.0 is copied from trunk in revision 3 and 1.1.0 in revision 5, each
+// has a README.txt with its version as contents. There is also a tag latest
+// that isn't a version. It returns the url of the repository.
+func svnTestRepo(t *T, dir string) string {
+	var run = func(name string, args ...string) {
+		cmd := exec.Command(name, args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s %v failed: %v\n%s", name, args, err, out)
+		}
+	}
+	var write = func(contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, "wc", "README.txt"),
+			[]byte(contents), 0660)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+
+	run("svnadmin", "create", "repo")
+	url := filepath.ToSlash(filepath.Join(dir, "repo"))
+	if url[0] != '/' {
+		url = "/" + url
+	}
+	url = "file://" + url
+
+	run("svn", "mkdir", "-q", "-m", "layout", url+"/trunk", url+"/tags")
+	run("svn", "checkout", "-q", url+"/trunk", "wc")
+	write("1.0.0")
+	run("svn", "add", "-q", filepath.Join("wc", "README.txt"))
+	run("svn", "commit", "-q", "-m", "first", "wc")
+	run("svn", "copy", "-q", "-m", "tag", url+"/trunk", url+"/tags/1.0.0")
+	write("1.1.0")
+	run("svn", "commit", "-q", "-m", "second", "wc")
+	run("svn", "copy", "-q", "-m", "tag", url+"/trunk", url+"/tags/1.1.0")
+	run("svn", "copy", "-q", "-m", "tag", url+"/trunk", url+"/tags/latest")
+	return url
+}
+
+func TestSvn(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	for _, tool := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool, "is not installed.")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gopacksvn")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	url := svnTestRepo(t, dir)
+
+	clone := filepath.Join(dir, "clone")
+	svn := NewSvn(clone)
+	if err = svn.Clone(url); err != nil {
+		t.Fatal("Failed to clone repository:", err)
+	}
+	if err = svn.Clone(url); err != nil {
+		t.Error("Expected no error on useless clone but got:", err)
+	}
+	if err = svn.Status(); err != nil {
+		t.Fatal("Status should not error if it is a repo:", err)
+	}
+	if dvcs, err := DetectDVCS(clone); err != nil {
+		t.Error("Unexpected error:", err)
+	} else if DVCSType(dvcs) != VCSSubversion {
+		t.Errorf("Expected a subversion repository, got: %T", dvcs)
+	}
+
+	if tag, err := svn.CurrentTag(); err != nil || tag != "" {
+		t.Error("Expected trunk to have no tag, got:", tag, err)
+	}
+	tags, err := svn.Tags()
+	if err != nil {
+		t.Fatal("Failed to retrieve tags:", err)
+	} else if len(tags) != 2 {
+		t.Error("Expected 2 tags, got:", len(tags), tags)
+	}
+	for _, tag := range tags {
+		if err = svn.Checkout(tag); err != nil {
+			t.Error("Failed to checkout tag:", err)
+		}
+		if ctag, err := svn.CurrentTag(); err != nil {
+			t.Error("Failed to retrieve current tag:", err)
+		} else if ctag != tag {
+			t.Errorf("Expected tag: %s, got: %s", tag, ctag)
+		}
+		read, err := ioutil.ReadFile(filepath.Join(clone, "README.txt"))
+		if err != nil || string(read) != tag {
+			t.Errorf("Expected the %s tree, got: %s %v", tag, read, err)
+		}
+	}
+
+	// Revision 2 is the first commit to trunk.
+	if err = svn.Checkout("2"); err != nil {
+		t.Error("Failed to checkout revision:", err)
+	}
+	if tag, err := svn.CurrentTag(); err != nil || tag != "" {
+		t.Error("Expected a revision to have no tag, got:", tag, err)
+	}
+	read, err := ioutil.ReadFile(filepath.Join(clone, "README.txt"))
+	if err != nil || string(read) != "1.0.0" {
+		t.Error("Expected the first commit, got:", string(read), err)
+	}
+	if err = svn.Update(); err != nil {
+		t.Error("Failed to update repository:", err)
+	}
+	ctx := context.Background()
+	meta := svn.(*Svn)
+	read, err = meta.ReadFile(ctx, "1.0.0", "README.txt")
+	if err != nil || string(read) != "1.0.0" {
+		t.Error("Expected the file in the tag, got:", string(read), err)
+	}
+	read, err = meta.ReadFile(ctx, "4", "README.txt")
+	if err != nil || string(read) != "1.1.0" {
+		t.Error("Expected the file at the revision, got:", string(read), err)
+	}
+	if _, err = meta.ReadFile(ctx, "1.0.0", PACKFILE); !os.IsNotExist(err) {
+		t.Error("Expected a not exist error, got:", err)
+	}
+
+	rev, err := meta.Revision(ctx, "1.0.0")
+	if err != nil || rev != "tags/1.0.0@3" {
+		t.Error("Expected the tag's revision, got:", rev, err)
+	}
+	if rev, err = meta.Revision(ctx, "4"); err != nil || rev != "trunk@4" {
+		t.Error("Expected trunk at the revision, got:", rev, err)
+	}
+
+	state, err := meta.RefState(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if same, _ := meta.RefState(ctx); same != state || len(state) == 0 {
+		t.Error("Expected the same ref state, got:", same)
+	}
+	cmd := exec.Command("svn", "copy", "-q", "-m", "tag", url+"/trunk",
+		url+"/tags/2.0.0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, out)
+	}
+	if changed, _ := meta.RefState(ctx); changed == state {
+		t.Error("Expected a new tag to change the ref state.")
+	}
+}
+
+func TestSvn_OlderTag(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	for _, tool := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool, "is not installed.")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gopacksvn")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Revision 7 tags the first commit to trunk, which trunk has since
+	// changed from.
+	url := svnTestRepo(t, dir)
+	cmd := exec.Command("svn", "copy", "-q", "-m", "tag", url+"/trunk@2",
+		url+"/tags/0.9.0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, out)
+	}
+
+	clone := filepath.Join(dir, "clone")
+	svn := NewSvn(clone)
+	if err = svn.Clone(url); err != nil {
+		t.Fatal("Failed to clone repository:", err)
+	}
+	ctx := context.Background()
+	meta := svn.(*Svn)
+
+	rev, err := meta.Revision(ctx, "0.9.0")
+	if err != nil || rev != "tags/0.9.0@7" {
+		t.Fatal("Expected the tag's revision, got:", rev, err)
+	}
+	if same, err := meta.Revision(ctx, rev); err != nil || same != rev {
+		t.Error("Expected a revision to be its own, got:", same, err)
+	}
+
+	read, err := meta.ReadFile(ctx, rev, "README.txt")
+	if err != nil || string(read) != "1.0.0" {
+		t.Error("Expected the tagged file, got:", string(read), err)
+	}
+	if err = svn.Checkout(rev); err != nil {
+		t.Fatal("Failed to checkout revision:", err)
+	}
+	read, err = ioutil.ReadFile(filepath.Join(clone, "README.txt"))
+	if err != nil || string(read) != "1.0.0" {
+		t.Error("Expected the tagged tree, got:", string(read), err)
+	}
+	if tag, err := svn.CurrentTag(); err != nil || tag != "0.9.0" {
+		t.Error("Expected the tag to be checked out, got:", tag, err)
+	}
+}
+
+func TestGit_CurrentTagUndescribed(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopackdescribe")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	gitTestRepo(t, dir)
+
+	// An orphan commit has tags in its repository but none it descends from.
+	for _, args := range [][]string{
+		{"checkout", "-q", "--orphan", "other"},
+		{"commit", "-q", "-m", "orphan"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=gopack", "GIT_AUTHOR_EMAIL=gopack@example.com",
+			"GIT_COMMITTER_NAME=gopack", "GIT_COMMITTER_EMAIL=gopack@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	tag, err := NewGit(dir).CurrentTag()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if tag != "" {
+		t.Error("Expected no current tag, got:", tag)
+	}
+}
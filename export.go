@@ -0,0 +1,198 @@
+package pack
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// environmentColors are the fill colors given to the nodes of each
+// environment in the order of Graph.Environments, they repeat when there are
+// more environments than colors. Nodes of the default Dependencies and the
+// root are not filled.
+var environmentColors = []string{
+	"#a6cee3", "#b2df8a", "#fb9a99", "#fdbf6f", "#cab2d6", "#ffff99",
+}
+
+// GraphNode is a package in the JSON form of a graph.
+type GraphNode struct {
+	Name        string       `json:"name"`
+	Version     string       `json:"version,omitempty"`
+	Environment string       `json:"environment"`
+	Edges       []*GraphEdge `json:"edges"`
+}
+
+// GraphEdge is a requirement in the JSON form of a graph. To is the package
+// the requirement is an edge to, and Name is the dependency as it was
+// declared which differs from To for subpackages.
+type GraphEdge struct {
+	To          string `json:"to"`
+	Name        string `json:"name"`
+	Constraints string `json:"constraints"`
+	Environment string `json:"environment"`
+}
+
+// GraphJSON is the JSON adjacency list form of a graph.
+type GraphJSON struct {
+	Root  string       `json:"root"`
+	Nodes []*GraphNode `json:"nodes"`
+}
+
+// JSON creates the adjacency list form of the graph, the nodes are in the
+// order of Nodes and the edges of each in the order of Edges.
+func (g *Graph) JSON() *GraphJSON {
+	envs := g.environments()
+	out := &GraphJSON{Root: g.Root, Nodes: []*GraphNode{}}
+	for _, name := range g.Nodes() {
+		node := &GraphNode{
+			Name:        name,
+			Environment: envs[name],
+			Edges:       []*GraphEdge{},
+		}
+		if v := g.Versions[name]; v != nil {
+			node.Version = v.String()
+		}
+		for _, req := range g.Edges[name] {
+			node.Edges = append(node.Edges, &GraphEdge{
+				To:          g.Node(req.Dependency.Name),
+				Name:        req.Dependency.Name,
+				Constraints: req.Dependency.Constraints.String(),
+				Environment: req.Environment,
+			})
+		}
+		out.Nodes = append(out.Nodes, node)
+	}
+	return out
+}
+
+// WriteJSON writes the graph to the writer in its JSON adjacency list form.
+func (g *Graph) WriteJSON(writer io.Writer) error {
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g.JSON())
+}
+
+// WriteDOT writes the graph to the writer in the Graphviz DOT language.
+// Nodes are labelled with their version and filled with the color of their
+// environment, edges are labelled with their constraints.
+func (g *Graph) WriteDOT(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	colors := g.environmentColors()
+	envs := g.environments()
+
+	fmt.Fprintln(w, "digraph dependencies {")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, name := range g.Nodes() {
+		fmt.Fprintf(w, "\t%s [label=%s", strconv.Quote(name),
+			strconv.Quote(nodeLabel(name, g.Versions[name], "\n")))
+		if color, ok := colors[envs[name]]; ok && name != g.Root {
+			fmt.Fprintf(w, ", style=filled, fillcolor=%s",
+				strconv.Quote(color))
+		}
+		fmt.Fprintln(w, "];")
+	}
+	for _, name := range g.Nodes() {
+		for _, req := range g.Edges[name] {
+			fmt.Fprintf(w, "\t%s -> %s", strconv.Quote(name),
+				strconv.Quote(g.Node(req.Dependency.Name)))
+			if label := edgeLabel(req); len(label) > 0 {
+				fmt.Fprintf(w, " [label=%s]", strconv.Quote(label))
+			}
+			fmt.Fprintln(w, ";")
+		}
+	}
+	fmt.Fprintln(w, "}")
+	return w.Flush()
+}
+
+// WriteMermaid writes the graph to the writer as a Mermaid flowchart. Nodes
+// and edges are labelled and colored in the same way as WriteDOT.
+func (g *Graph) WriteMermaid(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	colors := g.environmentColors()
+	envs := g.environments()
+	nodes := g.Nodes()
+
+	ids := make(map[string]string, len(nodes))
+	for i, name := range nodes {
+		ids[name] = "n" + strconv.Itoa(i)
+	}
+	id := func(name string) string {
+		if id, ok := ids[name]; ok {
+			return id
+		}
+		id := "n" + strconv.Itoa(len(ids))
+		ids[name] = id
+		return id
+	}
+
+	fmt.Fprintln(w, "graph TD")
+	for _, name := range nodes {
+		fmt.Fprintf(w, "\t%s[\"%s\"]\n", id(name),
+			mermaidText(nodeLabel(name, g.Versions[name], "<br/>")))
+	}
+	for _, name := range nodes {
+		for _, req := range g.Edges[name] {
+			to := g.Node(req.Dependency.Name)
+			if label := edgeLabel(req); len(label) > 0 {
+				fmt.Fprintf(w, "\t%s -->|\"%s\"| %s\n", id(name),
+					mermaidText(label), id(to))
+			} else {
+				fmt.Fprintf(w, "\t%s --> %s\n", id(name), id(to))
+			}
+		}
+	}
+	for i, env := range g.Environments() {
+		class := "env" + strconv.Itoa(i)
+		var members []string
+		for _, name := range nodes {
+			if name != g.Root && envs[name] == env {
+				members = append(members, id(name))
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\tclassDef %s fill:%s\n", class, colors[env])
+		fmt.Fprintf(w, "\tclass %s %s\n", strings.Join(members, ","), class)
+	}
+	return w.Flush()
+}
+
+// environmentColors assigns a color to each environment of the graph.
+func (g *Graph) environmentColors() map[string]string {
+	colors := make(map[string]string)
+	for i, env := range g.Environments() {
+		colors[env] = environmentColors[i%len(environmentColors)]
+	}
+	return colors
+}
+
+// nodeLabel is the name of a node followed by its version if it has one.
+func nodeLabel(name string, v *Version, sep string) string {
+	if v == nil {
+		return name
+	}
+	return name + sep + v.String()
+}
+
+// edgeLabel is the constraints of a requirement followed by the environment
+// it was declared in.
+func edgeLabel(req *Requirement) string {
+	var parts []string
+	if c := req.Dependency.Constraints.String(); len(c) > 0 {
+		parts = append(parts, c)
+	}
+	if len(req.Environment) > 0 {
+		parts = append(parts, "("+req.Environment+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// mermaidText escapes text for a quoted Mermaid label.
+func mermaidText(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
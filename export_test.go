@@ -0,0 +1,112 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	. "testing"
+)
+
+func testGraph(t *T) *Graph {
+	source := testSource{
+		"a": {"1.0.0": {"b >=1.0.0"}},
+		"b": {"1.2.0": nil},
+		"t": {"0.1.0": {"b"}},
+	}
+	root := testRoot(t, "a ~1.0.0")
+	root.Environments = map[string][]*Dependency{"test": {{Name: "t"}}}
+	r, err := Resolve(root, "test", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return NewGraph(r)
+}
+
+func TestGraph_Environment(t *T) {
+	t.Parallel()
+
+	g := testGraph(t)
+	if envs := g.Environments(); len(envs) != 1 || envs[0] != "test" {
+		t.Error("Unexpected environments:", envs)
+	}
+	for name, env := range map[string]string{"a": "", "b": "", "t": "test"} {
+		if got := g.Environment(name); got != env {
+			t.Errorf("%s: expected environment %q, got: %q", name, env, got)
+		}
+	}
+}
+
+func TestGraph_WriteDOT(t *T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := testGraph(t).WriteDOT(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	dot := buf.String()
+	var exp = []string{
+		"digraph dependencies {\n",
+		"\t\"app\" [label=\"app\"];\n",
+		"\t\"a\" [label=\"a\\n1.0.0\"];\n",
+		"\t\"t\" [label=\"t\\n0.1.0\", style=filled, fillcolor=\"#a6cee3\"];\n",
+		"\t\"app\" -> \"a\" [label=\"~1.0.0\"];\n",
+		"\t\"app\" -> \"t\" [label=\"(test)\"];\n",
+		"\t\"t\" -> \"b\";\n",
+	}
+	for _, e := range exp {
+		if !strings.Contains(dot, e) {
+			t.Errorf("Expected %q in:\n%s", e, dot)
+		}
+	}
+}
+
+func TestGraph_WriteMermaid(t *T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := testGraph(t).WriteMermaid(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	mermaid := buf.String()
+	var exp = []string{
+		"graph TD\n",
+		"\tn0[\"app\"]\n",
+		"\tn1[\"a<br/>1.0.0\"]\n",
+		"\tn0 -->|\"~1.0.0\"| n1\n",
+		"\tn3 --> n2\n",
+		"\tclassDef env0 fill:#a6cee3\n",
+		"\tclass n3 env0\n",
+	}
+	for _, e := range exp {
+		if !strings.Contains(mermaid, e) {
+			t.Errorf("Expected %q in:\n%s", e, mermaid)
+		}
+	}
+}
+
+func TestGraph_WriteJSON(t *T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := testGraph(t).WriteJSON(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var decoded GraphJSON
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if decoded.Root != "app" || len(decoded.Nodes) != 4 {
+		t.Fatal("Unexpected graph:", buf.String())
+	}
+	root := decoded.Nodes[0]
+	if len(root.Edges) != 2 || root.Edges[1].To != "t" ||
+		root.Edges[1].Environment != "test" {
+
+		t.Error("Unexpected root edges:", buf.String())
+	}
+	if tn := decoded.Nodes[3]; tn.Name != "t" || tn.Version != "0.1.0" ||
+		tn.Environment != "test" {
+
+		t.Error("Unexpected node:", tn)
+	}
+}
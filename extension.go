@@ -0,0 +1,86 @@
+package pack
+
+import (
+	"fmt"
+	"launchpad.net/goyaml"
+	"reflect"
+	"strings"
+)
+
+const (
+	errFmtExtension = `pack: [%v] is a pack field and cannot be an extension`
+)
+
+var (
+	packFieldNames = yamlFieldNames(reflect.TypeOf(Pack{}))
+)
+
+// Extension decodes the extension stored under key into out, which must be a
+// pointer as given to a yaml unmarshaller. It returns false if there is no
+// such extension.
+func (p *Pack) Extension(key string, out interface{}) (bool, error) {
+	value, ok := p.Extensions[key]
+	if !ok {
+		return false, nil
+	}
+
+	encoded, err := goyaml.Marshal(value)
+	if err != nil {
+		return true, err
+	}
+	return true, goyaml.Unmarshal(encoded, out)
+}
+
+// SetExtension encodes value and stores it under key, replacing any existing
+// value. Keys that belong to the pack format itself are rejected.
+func (p *Pack) SetExtension(key string, value interface{}) error {
+	if isPackField(key) {
+		return fmt.Errorf(errFmtExtension, key)
+	}
+
+	encoded, err := goyaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err = goyaml.Unmarshal(encoded, &decoded); err != nil {
+		return err
+	}
+
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]interface{})
+	}
+	p.Extensions[key] = decoded
+	return nil
+}
+
+// DeleteExtension removes the extension stored under key.
+func (p *Pack) DeleteExtension(key string) {
+	delete(p.Extensions, key)
+}
+
+// isPackField checks if the key is one of the yaml keys of a Pack.
+func isPackField(key string) bool {
+	return packFieldNames[key]
+}
+
+// yamlFieldNames returns the set of keys goyaml uses for a struct's fields.
+func yamlFieldNames(typ reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+		names[name] = true
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+package pack
+
+import (
+	"bytes"
+	"strings"
+	. "testing"
+)
+
+var testExtensionPack = `name: package
+version: 1.0.0
+x-ci:
+  image: golang
+  steps:
+  - go vet
+  - go test
+x-owner: team
+`
+
+type testCI struct {
+	Image string
+	Steps []string
+}
+
+func TestPack_Extensions(t *T) {
+	t.Parallel()
+
+	p := mustParsePack(t, testExtensionPack)
+	if ln := len(p.Extensions); ln != 2 {
+		t.Fatal("Expected 2 extensions, got:", p.Extensions)
+	}
+	if _, ok := p.Extensions["name"]; ok {
+		t.Error("Pack fields should not be extensions.")
+	}
+
+	var ci testCI
+	if ok, err := p.Extension("x-ci", &ci); err != nil {
+		t.Error("Unexpected error:", err)
+	} else if !ok {
+		t.Error("Expected the extension to exist.")
+	}
+	if ci.Image != "golang" || len(ci.Steps) != 2 {
+		t.Error("Unexpected decoded extension:", ci)
+	}
+
+	var missing testCI
+	if ok, err := p.Extension("x-missing", &missing); err != nil || ok {
+		t.Error("Expected a missing extension, got:", ok, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := p.WriteTo(buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "x-ci:") || !strings.Contains(out, "x-owner:") {
+		t.Error("Expected extensions to be written, got:\n", out)
+	}
+
+	p = mustParsePack(t, out)
+	var owner string
+	if ok, err := p.Extension("x-owner", &owner); !ok || err != nil {
+		t.Error("Expected the extension to round trip:", ok, err)
+	} else if owner != "team" {
+		t.Error("Expected team, got:", owner)
+	}
+	if p.Name != "package" {
+		t.Error("Expected the name to round trip, got:", p.Name)
+	}
+}
+
+func TestPack_SetExtension(t *T) {
+	t.Parallel()
+
+	p := &Pack{}
+	if err := p.SetExtension("name", "nope"); err == nil {
+		t.Error("Expected an error setting a pack field.")
+	}
+
+	err := p.SetExtension("x-ci", testCI{"golang", []string{"go test"}})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = p.WriteTo(buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if out := buf.String(); strings.Contains(out, "{}") {
+		t.Error("Expected only the extensions to be written, got:\n", out)
+	}
+
+	p = mustParsePack(t, buf.String())
+	var ci testCI
+	if ok, err := p.Extension("x-ci", &ci); !ok || err != nil {
+		t.Fatal("Expected the extension to round trip:", ok, err)
+	}
+	if ci.Image != "golang" || len(ci.Steps) != 1 {
+		t.Error("Unexpected decoded extension:", ci)
+	}
+
+	p.DeleteExtension("x-ci")
+	if len(p.Extensions) != 0 {
+		t.Error("Expected the extension to be deleted.")
+	}
+}
@@ -0,0 +1,262 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultFetchWorkers is how many lookups a Fetcher does at once when
+	// Workers is not set.
+	DefaultFetchWorkers = 8
+)
+
+// FetchError holds the errors of every dependency that could not be fetched.
+type FetchError struct {
+	// Errors are the first error of each dependency by name.
+	Errors map[string]error
+}
+
+// Error implements the error interface.
+func (e *FetchError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("pack: failed to fetch: ")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(name)
+		buf.WriteString(": ")
+		buf.WriteString(e.Errors[name].Error())
+	}
+	return buf.String()
+}
+
+// Fetcher looks up the versions and packs of many packages from a
+// VersionSource concurrently. At most Workers lookups run at once across all
+// calls to a Fetcher, and concurrent lookups of the same package or pack
+// share a single call to the source. A Fetcher must not be copied after it
+// is first used.
+type Fetcher struct {
+	// Source is where the metadata is looked up.
+	Source VersionSource
+	// Workers is the limit on concurrent lookups, DefaultFetchWorkers when it
+	// is not positive.
+	Workers int
+
+	once  sync.Once
+	sem   chan struct{}
+	mut   sync.Mutex
+	calls map[string]*fetchCall
+}
+
+// fetchCall is a lookup that is in flight.
+type fetchCall struct {
+	done     chan struct{}
+	versions []*Version
+	pack     *Pack
+	err      error
+}
+
+// NewFetcher creates a fetcher that uses source with a limit of workers
+// concurrent lookups.
+func NewFetcher(source VersionSource, workers int) *Fetcher {
+	return &Fetcher{Source: source, Workers: workers}
+}
+
+// FetchPack fetches the dependencies of root in the environment as described
+// by Fetch.
+func (f *Fetcher) FetchPack(ctx context.Context, root *Pack, env string) (
+	*MemorySource, error) {
+
+	self := packName(root)
+	var names []string
+	for _, dep := range root.EnvironmentDependencies(env) {
+		if dep.Name != self {
+			names = append(names, dep.Name)
+		}
+	}
+	return f.Fetch(ctx, names...)
+}
+
+// Fetch looks up every version of the named packages and their packs at
+// each version, following the dependencies of those packs until everything
+// they can reach has been fetched. The result can be resolved without going
+// back to the source. When some dependencies fail the rest are still
+// fetched, and a *FetchError with the error of each failed dependency is
+// returned along with everything that succeeded. When ctx is done no more
+// lookups are started, those in flight are given ctx to stop them, and
+// ctx.Err() is returned.
+func (f *Fetcher) Fetch(ctx context.Context, names ...string) (*MemorySource,
+	error) {
+
+	f.once.Do(f.init)
+
+	out := NewMemorySource()
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+	seen := make(map[string]bool)
+	errs := make(map[string]error)
+
+	fail := func(name string, err error) {
+		mut.Lock()
+		defer mut.Unlock()
+		if _, ok := errs[name]; !ok {
+			errs[name] = err
+		}
+	}
+
+	var fetchPack func(name string, v *Version)
+	var fetchVersions func(name string)
+	fetchVersions = func(name string) {
+		mut.Lock()
+		defer mut.Unlock()
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			versions, err := f.Versions(ctx, name)
+			if err != nil {
+				fail(name, err)
+				return
+			}
+			out.addName(name)
+			for _, v := range versions {
+				fetchPack(name, v)
+			}
+		}()
+	}
+	fetchPack = func(name string, v *Version) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := f.Pack(ctx, name, v)
+			if err != nil {
+				fail(name, err)
+				return
+			}
+			out.Add(name, v, p)
+			for _, dep := range p.Dependencies {
+				if dep.Name != name {
+					fetchVersions(dep.Name)
+				}
+			}
+		}()
+	}
+
+	for _, name := range names {
+		fetchVersions(name)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return out, err
+	}
+	if len(errs) > 0 {
+		return out, &FetchError{errs}
+	}
+	return out, nil
+}
+
+// Versions looks up the versions of a package, sharing the lookup with any
+// other caller that is looking up the same package.
+func (f *Fetcher) Versions(ctx context.Context, name string) ([]*Version,
+	error) {
+
+	c, err := f.do(ctx, "versions\x00"+name, func(c *fetchCall) {
+		c.versions, c.err = f.Source.Versions(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.versions, c.err
+}
+
+// Pack looks up the pack of a package at a version, sharing the lookup with
+// any other caller that is looking up the same pack.
+func (f *Fetcher) Pack(ctx context.Context, name string, v *Version) (*Pack,
+	error) {
+
+	c, err := f.do(ctx, "pack\x00"+name+"@"+v.String(), func(c *fetchCall) {
+		c.pack, c.err = f.Source.Pack(ctx, name, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.err == nil && c.pack == nil {
+		return &Pack{}, nil
+	}
+	return c.pack, c.err
+}
+
+// init creates the worker semaphore and the in flight calls.
+func (f *Fetcher) init() {
+	workers := f.Workers
+	if workers <= 0 {
+		workers = DefaultFetchWorkers
+	}
+	f.sem = make(chan struct{}, workers)
+	f.calls = make(map[string]*fetchCall)
+}
+
+// do runs lookup once for all the callers of a key that arrive while it is in
+// flight. The lookup waits for a free worker, the error returned is only for
+// ctx being done, the lookup's own error is in the call. The lookup runs with
+// the context of the caller that started it, so when that caller gives up
+// the waiting callers that haven't given up start it again.
+func (f *Fetcher) do(ctx context.Context, key string,
+	lookup func(*fetchCall)) (*fetchCall, error) {
+
+	f.once.Do(f.init)
+
+	f.mut.Lock()
+	if c, ok := f.calls[key]; ok {
+		f.mut.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if isContextErr(c.err) && ctx.Err() == nil {
+			return f.do(ctx, key, lookup)
+		}
+		return c, nil
+	}
+	c := &fetchCall{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mut.Unlock()
+
+	defer func() {
+		f.mut.Lock()
+		delete(f.calls, key)
+		f.mut.Unlock()
+		close(c.done)
+	}()
+
+	select {
+	case f.sem <- struct{}{}:
+	case <-ctx.Done():
+		c.err = ctx.Err()
+		return nil, c.err
+	}
+	defer func() { <-f.sem }()
+
+	if err := ctx.Err(); err != nil {
+		c.err = err
+		return nil, err
+	}
+	lookup(c)
+	return c, nil
+}
@@ -0,0 +1,237 @@
+package pack
+
+import (
+	"context"
+	"errors"
+	"sync"
+	. "testing"
+	"time"
+)
+
+// countingSource wraps a VersionSource to count lookups and measure how many
+// run at once.
+type countingSource struct {
+	VersionSource
+	delay time.Duration
+	fail  map[string]bool
+
+	mut     sync.Mutex
+	calls   map[string]int
+	running int
+	peak    int
+}
+
+func (c *countingSource) enter(key string) {
+	c.mut.Lock()
+	c.calls[key]++
+	c.running++
+	if c.running > c.peak {
+		c.peak = c.running
+	}
+	c.mut.Unlock()
+	time.Sleep(c.delay)
+}
+
+func (c *countingSource) leave() {
+	c.mut.Lock()
+	c.running--
+	c.mut.Unlock()
+}
+
+func (c *countingSource) Versions(ctx context.Context, name string) (
+	[]*Version, error) {
+
+	c.enter(name)
+	defer c.leave()
+	if c.fail[name] {
+		return nil, errors.New("unreachable")
+	}
+	return c.VersionSource.Versions(ctx, name)
+}
+
+func (c *countingSource) Pack(ctx context.Context, name string,
+	v *Version) (*Pack, error) {
+
+	c.enter(name + "@" + v.String())
+	defer c.leave()
+	return c.VersionSource.Pack(ctx, name, v)
+}
+
+func newCountingSource(t *T, s testSource) *countingSource {
+	return &countingSource{
+		VersionSource: s.source(t),
+		delay:         5 * time.Millisecond,
+		fail:          make(map[string]bool),
+		calls:         make(map[string]int),
+	}
+}
+
+func TestFetcher_Fetch(t *T) {
+	t.Parallel()
+
+	source := newCountingSource(t, testSource{
+		"a": {"1.0.0": {"b"}, "1.1.0": {"b", "c"}},
+		"b": {"1.0.0": {"a"}, "2.0.0": nil},
+		"c": {"1.0.0": {"x"}},
+		"x": {"1.0.0": nil},
+		"u": {"1.0.0": nil},
+	})
+	source.fail["x"] = true
+
+	f := NewFetcher(source, 2)
+	fetched, err := f.FetchPack(context.Background(), testRoot(t, "a", "app"),
+		"")
+	fetchErr, ok := err.(*FetchError)
+	if !ok {
+		t.Fatal("Expected a fetch error, got:", err)
+	}
+	if len(fetchErr.Errors) != 1 || fetchErr.Errors["x"] == nil {
+		t.Error("Expected only x to fail, got:", fetchErr)
+	}
+
+	for name, count := range map[string]int{"a": 2, "b": 2, "c": 1} {
+		versions, err := fetched.Versions(context.Background(), name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if len(versions) != count {
+			t.Errorf("%s: expected %d versions, got: %v", name, count,
+				versions)
+		}
+	}
+	if _, err = fetched.Versions(context.Background(), "u"); err == nil {
+		t.Error("Expected u not to be fetched.")
+	}
+
+	for key, count := range source.calls {
+		if count != 1 {
+			t.Errorf("Expected %s to be looked up once, got: %d", key, count)
+		}
+	}
+	if source.peak > 2 {
+		t.Error("Expected at most 2 lookups at once, got:", source.peak)
+	}
+
+	r, err := Resolve(testRoot(t, "a <1.1.0"), "", fetched)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{"a": "1.0.0", "b": "2.0.0"})
+}
+
+func TestFetcher_Dedupe(t *T) {
+	t.Parallel()
+
+	source := newCountingSource(t, testSource{"a": {"1.0.0": nil}})
+	source.delay = 50 * time.Millisecond
+	f := NewFetcher(source, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Versions(context.Background(), "a"); err != nil {
+				t.Error("Unexpected error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := source.calls["a"]; count != 1 {
+		t.Error("Expected concurrent lookups to be shared, got:", count)
+	}
+	if _, err := f.Versions(context.Background(), "a"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if count := source.calls["a"]; count != 2 {
+		t.Error("Expected a finished lookup not to be cached, got:", count)
+	}
+}
+
+// blockingSource wraps a VersionSource so that looking up versions blocks
+// until it is released or the lookup's context is done.
+type blockingSource struct {
+	VersionSource
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSource) Versions(ctx context.Context, name string) (
+	[]*Version, error) {
+
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return b.VersionSource.Versions(ctx, name)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestFetcher_CancelShared(t *T) {
+	t.Parallel()
+
+	source := &blockingSource{
+		VersionSource: testSource{"a": {"1.0.0": nil}}.source(t),
+		started:       make(chan struct{}, 2),
+		release:       make(chan struct{}),
+	}
+	f := NewFetcher(source, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := f.Versions(ctx, "a")
+		first <- err
+	}()
+	<-source.started
+
+	type result struct {
+		versions []*Version
+		err      error
+	}
+	second := make(chan result, 1)
+	go func() {
+		versions, err := f.Versions(context.Background(), "a")
+		second <- result{versions, err}
+	}()
+	// Give the second caller time to start waiting on the first's lookup.
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Error("Expected the first caller to be canceled, got:", err)
+	}
+	<-source.started
+	close(source.release)
+
+	res := <-second
+	if res.err != nil {
+		t.Error("Unexpected error:", res.err)
+	} else if len(res.versions) != 1 {
+		t.Error("Expected the versions, got:", res.versions)
+	}
+}
+
+func TestFetcher_Cancel(t *T) {
+	t.Parallel()
+
+	source := newCountingSource(t, testSource{
+		"a": {"1.0.0": {"b"}},
+		"b": {"1.0.0": {"c"}},
+		"c": {"1.0.0": nil},
+	})
+	source.delay = 20 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer cancel()
+
+	_, err := NewFetcher(source, 1).Fetch(ctx, "a")
+	if err != context.DeadlineExceeded {
+		t.Error("Expected the deadline to be exceeded, got:", err)
+	}
+	if _, ok := source.calls["c"]; ok {
+		t.Error("Expected no lookups after the context was done.")
+	}
+}
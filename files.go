@@ -1,7 +1,36 @@
 package pack
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// PACKFILE is the name of the pack file in the root of a package.
+	PACKFILE = "pack.yaml"
+	// LOCKSUFFIX is appended to a filename to create its lock file.
+	LOCKSUFFIX = ".flock"
+
+	// packFileMode is the mode of newly created pack files.
+	packFileMode = 0644
+	// lockRetryInterval is how often a held lock is retried.
+	lockRetryInterval = 10 * time.Millisecond
+	// lockStaleAge is how old a lock file must be before it's taken over even
+	// though the process that holds it can't be shown to be dead.
+	lockStaleAge = time.Hour
+)
+
+var (
+	errLockTimeout = errors.New(`pack: Timed out waiting for file lock.`)
 )
 
 // ParsePackFile opens a file for reading and parses it into a Pack.
@@ -16,14 +45,195 @@ func ParsePackFile(filename string) (p *Pack, err error) {
 	return
 }
 
-// WritePackFile opens a file for writing and writes the Pack to it.
-func (p *Pack) WritePackFile(filename string) (err error) {
+// WritePackFile writes the Pack to the file atomically. The pack is written
+// to a temporary file in the same directory which is synced to disk and then
+// renamed over the original, so the file is never left partially written. The
+// original file's permissions are preserved.
+func (p *Pack) WritePackFile(filename string) error {
+	return writeFileAtomic(filename, p.WriteTo)
+}
+
+// writeFileAtomic replaces filename with what write writes, as described by
+// WritePackFile.
+func writeFileAtomic(filename string, write func(io.Writer) error) (err error) {
+	var mode os.FileMode = packFileMode
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(filename)
+	if len(dir) == 0 {
+		dir = "."
+	}
+
 	var file *os.File
-	file, err = os.Create(filename)
+	file, err = ioutil.TempFile(dir, "."+base+".")
 	if err != nil {
 		return
 	}
-	defer file.Close()
-	err = p.WriteTo(file)
-	return
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err = write(file); err != nil {
+		return
+	}
+	if err = file.Sync(); err != nil {
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	if err = os.Chmod(file.Name(), mode); err != nil {
+		return
+	}
+	if err = os.Rename(file.Name(), filename); err != nil {
+		return
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory's entries to disk so that a rename within it is
+// durable. Not every platform supports this so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// FileLock is an advisory lock on a file. It is held by the existence of a
+// lock file next to the locked file, so it only excludes others that use
+// FileLock as well.
+type FileLock struct {
+	path string
+}
+
+// LockFile acquires the lock for filename, waiting up to timeout for another
+// holder to release it. A timeout of zero tries only once. A lock left behind
+// by a process that is no longer running, or that is older than an hour, is
+// taken over.
+func LockFile(filename string, timeout time.Duration) (*FileLock, error) {
+	path := filename + LOCKSUFFIX
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return &FileLock{path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if breakStaleLock(path) {
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, errLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// breakStaleLock removes the lock file at path if its holder is dead or it's
+// older than lockStaleAge, and reports whether it did. The lock is moved
+// aside before being removed so that if another process took it over first,
+// its fresh lock can be put back instead of being deleted.
+func breakStaleLock(path string) bool {
+	pid, modified, err := readLock(path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	if processAlive(pid) && time.Since(modified) < lockStaleAge {
+		return false
+	}
+
+	aside := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err = os.Rename(path, aside); err != nil {
+		return os.IsNotExist(err)
+	}
+	asidePID, asideModified, err := readLock(aside)
+	if err == nil && (asidePID != pid || !asideModified.Equal(modified)) {
+		// Another process broke the stale lock and acquired a new one
+		// before we moved it, it must be restored.
+		os.Rename(aside, path)
+		return false
+	}
+	os.Remove(aside)
+	return true
+}
+
+// readLock returns the pid written to a lock file and when it was written.
+// The pid is zero when the file's contents can't be read as one.
+func readLock(path string) (pid int, modified time.Time, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, modified, err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, modified, err
+	}
+	pid, _ = strconv.Atoi(strings.TrimSpace(string(contents)))
+	return pid, info.ModTime(), nil
+}
+
+// processAlive checks if the process with pid is running. A pid that can't
+// be checked is assumed to be alive, the lock's age decides in that case.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return true
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		// FindProcess only fails on windows, where it opens the process.
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		proc.Release()
+		return true
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	return os.Remove(l.path)
+}
+
+// UpdatePackFile locks the pack file, parses it, calls update with the pack
+// and writes it back if update does not return an error. The lock is held
+// for the entire read-modify-write so concurrent updates do not interleave.
+func UpdatePackFile(filename string, timeout time.Duration,
+	update func(*Pack) error) (err error) {
+
+	lock, err := LockFile(filename, timeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := lock.Unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	p, err := ParsePackFile(filename)
+	if err != nil {
+		return err
+	}
+	if err = update(p); err != nil {
+		return err
+	}
+	return p.WritePackFile(filename)
 }
@@ -0,0 +1,204 @@
+package pack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	. "testing"
+	"time"
+)
+
+func TestPack_WritePackFile(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackfiles")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "pack.yaml")
+	p := mustParsePack(t, testPack)
+	if err = p.WritePackFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != packFileMode {
+		t.Errorf("Expected mode: %v, got: %v", os.FileMode(packFileMode),
+			info.Mode().Perm())
+	}
+
+	if err = os.Chmod(filename, 0600); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	p.Name = "renamed"
+	if err = p.WritePackFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Error("Expected the mode to be preserved, got:", info.Mode().Perm())
+	}
+
+	p, err = ParsePackFile(filename)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if p.Name != "renamed" {
+		t.Error("Expected the new name, got:", p.Name)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(files) != 1 {
+		t.Error("Expected no temporary files to be left, got:", len(files))
+	}
+
+	err = p.WritePackFile(filepath.Join(dir, "missing", "pack.yaml"))
+	if err == nil {
+		t.Error("Expected an error writing to a missing directory.")
+	}
+}
+
+func TestLockFile(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopacklock")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "pack.yaml")
+	lock, err := LockFile(filename, 0)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = LockFile(filename, 20*time.Millisecond); err != errLockTimeout {
+		t.Error("Expected a lock timeout, got:", err)
+	}
+	if err = lock.Unlock(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if lock, err = LockFile(filename, 0); err != nil {
+		t.Error("Expected to reacquire the lock, got:", err)
+	} else {
+		lock.Unlock()
+	}
+}
+
+func TestLockFile_Stale(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopacklockstale")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A process that has exited leaves behind a pid that is not running.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err = cmd.Run(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	deadPID := cmd.Process.Pid
+
+	filename := filepath.Join(dir, "pack.yaml")
+	path := filename + LOCKSUFFIX
+	err = ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", deadPID)), 0644)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	lock, err := LockFile(filename, 0)
+	if err != nil {
+		t.Fatal("Expected the dead holder's lock to be taken over, got:", err)
+	}
+	lock.Unlock()
+
+	// A lock held by a live process is only taken over once it's old.
+	live := []byte(fmt.Sprintf("%d\n", os.Getpid()))
+	if err = ioutil.WriteFile(path, live, 0644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = LockFile(filename, 0); err != errLockTimeout {
+		t.Error("Expected a lock timeout, got:", err)
+	}
+	old := time.Now().Add(-2 * lockStaleAge)
+	if err = os.Chtimes(path, old, old); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if lock, err = LockFile(filename, 0); err != nil {
+		t.Fatal("Expected the old lock to be taken over, got:", err)
+	}
+	lock.Unlock()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(files) != 0 {
+		t.Error("Expected no lock files to be left, got:", len(files))
+	}
+}
+
+func TestUpdatePackFile(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackupdate")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "pack.yaml")
+	if err = (&Pack{Name: "package"}).WritePackFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	const updaters = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, updaters)
+	for i := 0; i < updaters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- UpdatePackFile(filename, 5*time.Second, func(p *Pack) error {
+				p.Subpackages = append(p.Subpackages, "sub")
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+
+	p, err := ParsePackFile(filename)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if ln := len(p.Subpackages); ln != updaters {
+		t.Error("Expected every update to be kept, got:", ln)
+	}
+
+	err = UpdatePackFile(filename, 0, func(p *Pack) error {
+		return fakeError
+	})
+	if err != fakeError {
+		t.Error("Expected the update error, got:", err)
+	}
+	if exists, _ := FileExists(filename + LOCKSUFFIX); exists {
+		t.Error("Expected the lock to be released.")
+	}
+}
@@ -0,0 +1,253 @@
+package pack
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Graph is the dependency graph of a resolution. A package's Subpackages are
+// part of the package, so requirements on a subpackage are edges to the
+// package that declares it.
+type Graph struct {
+	// Root is the name of the root pack.
+	Root string
+	// Versions are the selected versions of each package, the root has none.
+	Versions map[string]*Version
+	// Edges are the requirements declared by each package in the order they
+	// were discovered.
+	Edges map[string][]*Requirement
+
+	owners map[string]string
+}
+
+// NewGraph creates the graph of a resolution.
+func NewGraph(r *Resolution) *Graph {
+	g := &Graph{
+		Root:     packName(r.Root),
+		Versions: make(map[string]*Version),
+		Edges:    make(map[string][]*Requirement),
+		owners:   make(map[string]string),
+	}
+
+	g.addOwner(g.Root, r.Root)
+	for _, name := range r.Names() {
+		g.addOwner(name, r.Packs[name])
+	}
+	for name, v := range r.Versions {
+		if node := g.Node(name); node != g.Root {
+			if _, ok := g.Versions[node]; !ok || node == name {
+				g.Versions[node] = v
+			}
+		}
+	}
+	for _, req := range r.Requirements {
+		from := g.Node(req.From)
+		g.Edges[from] = append(g.Edges[from], req)
+	}
+	return g
+}
+
+// addOwner records the package that each of a pack's subpackages belong to.
+// A resolved name that is inside the import path of its own pack belongs to
+// that pack as well.
+func (g *Graph) addOwner(name string, p *Pack) {
+	if p == nil {
+		return
+	}
+	owner := name
+	if len(p.ImportPath) > 0 && strings.HasPrefix(name, p.ImportPath+"/") {
+		owner = p.ImportPath
+		g.owners[name] = owner
+	}
+	for _, sub := range p.Subpackages {
+		g.owners[owner+"/"+strings.Trim(sub, "/")] = owner
+	}
+}
+
+// Node returns the package in the graph that a name belongs to, which is the
+// name itself unless it is a subpackage.
+func (g *Graph) Node(name string) string {
+	if owner, ok := g.owners[name]; ok {
+		return owner
+	}
+	return name
+}
+
+// Nodes returns every package in the graph, the root first and then the
+// rest in sorted order.
+func (g *Graph) Nodes() []string {
+	nodes := make([]string, 0, len(g.Versions)+1)
+	for name := range g.Versions {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	return append([]string{g.Root}, nodes...)
+}
+
+// Environment returns the environment that brought a package into the
+// graph. It is empty when the package is reached through the root's default
+// Dependencies, otherwise it is the first environment, in sorted order, that
+// reaches it.
+func (g *Graph) Environment(name string) string {
+	return g.environments()[g.Node(name)]
+}
+
+// Environments returns the environments of the root's requirements in sorted
+// order, the default Dependencies are not included.
+func (g *Graph) Environments() []string {
+	seen := make(map[string]bool)
+	var envs []string
+	for _, req := range g.Edges[g.Root] {
+		if len(req.Environment) > 0 && !seen[req.Environment] {
+			seen[req.Environment] = true
+			envs = append(envs, req.Environment)
+		}
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// environments finds the environment of every package in the graph.
+func (g *Graph) environments() map[string]string {
+	envs := make(map[string]string)
+	var walk func(node, env string)
+	walk = func(node, env string) {
+		for _, req := range g.Edges[node] {
+			next := g.Node(req.Dependency.Name)
+			if _, ok := envs[next]; ok || next == g.Root {
+				continue
+			}
+			envs[next] = env
+			walk(next, env)
+		}
+	}
+
+	for _, env := range append([]string{""}, g.Environments()...) {
+		for _, req := range g.Edges[g.Root] {
+			next := g.Node(req.Dependency.Name)
+			if _, ok := envs[next]; ok || req.Environment != env ||
+				next == g.Root {
+
+				continue
+			}
+			envs[next] = env
+			walk(next, env)
+		}
+	}
+	return envs
+}
+
+// Cycle is a loop in the dependency graph.
+type Cycle struct {
+	// Requirements form the loop in order, the last requirement is on the
+	// package that declared the first.
+	Requirements []*Requirement
+}
+
+// Path returns the names along the cycle starting and ending with the same
+// package. Names are as they were declared, so a subpackage is shown rather
+// than the package it belongs to.
+func (c *Cycle) Path() []string {
+	if len(c.Requirements) == 0 {
+		return nil
+	}
+	path := make([]string, 0, len(c.Requirements)+1)
+	path = append(path, c.Requirements[0].From)
+	for _, req := range c.Requirements {
+		path = append(path, req.Dependency.Name)
+	}
+	return path
+}
+
+// String describes the cycle, ie. a -> b/sub -> a
+func (c *Cycle) String() string {
+	return strings.Join(c.Path(), " -> ")
+}
+
+// CyclePolicy decides what CheckCycles does with the cycles it finds.
+type CyclePolicy int
+
+// Defines the cycle policies.
+const (
+	// CyclesWarn reports cycles without failing.
+	CyclesWarn CyclePolicy = iota
+	// CyclesError fails with a *CycleError when there are cycles.
+	CyclesError
+)
+
+// CycleError is returned by CheckCycles when cycles are not allowed.
+type CycleError struct {
+	Cycles []*Cycle
+}
+
+// Error implements the error interface.
+func (c *CycleError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString("pack: dependency cycles: ")
+	for i, cycle := range c.Cycles {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(cycle.String())
+	}
+	return buf.String()
+}
+
+// Cycles finds every elementary cycle in the graph, a loop that visits no
+// package twice. Each is reported once, starting from the package in it that
+// comes first in Nodes. Requirements of a package on its own subpackages are
+// not cycles.
+func (g *Graph) Cycles() []*Cycle {
+	var cycles []*Cycle
+	nodes := g.Nodes()
+	order := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		order[node] = i
+	}
+
+	var start string
+	onPath := make(map[string]bool)
+	var path []*Requirement
+
+	// visit follows every path from node that only goes through packages
+	// after start, recording those that lead back to start.
+	var visit func(node string)
+	visit = func(node string) {
+		onPath[node] = true
+		for _, req := range g.Edges[node] {
+			next := g.Node(req.Dependency.Name)
+			if i, ok := order[next]; next == node || !ok || i < order[start] {
+				continue
+			}
+			if next == start {
+				loop := make([]*Requirement, 0, len(path)+1)
+				loop = append(loop, path...)
+				cycles = append(cycles, &Cycle{append(loop, req)})
+				continue
+			}
+			if onPath[next] {
+				continue
+			}
+			path = append(path, req)
+			visit(next)
+			path = path[:len(path)-1]
+		}
+		delete(onPath, node)
+	}
+
+	for _, start = range nodes {
+		visit(start)
+	}
+	return cycles
+}
+
+// CheckCycles finds the cycles in the graph. With CyclesError any cycle
+// results in a *CycleError, with CyclesWarn they are only returned.
+func (g *Graph) CheckCycles(policy CyclePolicy) ([]*Cycle, error) {
+	cycles := g.Cycles()
+	if policy == CyclesError && len(cycles) > 0 {
+		return cycles, &CycleError{cycles}
+	}
+	return cycles, nil
+}
@@ -0,0 +1,144 @@
+package pack
+
+import (
+	"strings"
+	. "testing"
+)
+
+func TestGraph(t *T) {
+	t.Parallel()
+
+	source := NewMemorySource()
+	v, _ := ParseVersion("1.0.0")
+	source.Add("a", v, &Pack{
+		ImportPath:   "a",
+		Dependencies: []*Dependency{{Name: "b/sub"}},
+	})
+	source.Add("b", v, &Pack{ImportPath: "b", Subpackages: []string{"sub"}})
+	source.Add("b/sub", v, &Pack{
+		ImportPath:   "b",
+		Dependencies: []*Dependency{{Name: "c"}},
+	})
+	source.Add("c", v, &Pack{ImportPath: "c"})
+
+	r, err := Resolve(testRoot(t, "a", "b"), "", source)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	g := NewGraph(r)
+	if g.Root != "app" {
+		t.Error("Expected the root to be app, got:", g.Root)
+	}
+	if g.Node("b/sub") != "b" || g.Node("a") != "a" {
+		t.Error("Expected b/sub to belong to b.")
+	}
+	if nodes := strings.Join(g.Nodes(), " "); nodes != "app a b c" {
+		t.Error("Unexpected nodes:", nodes)
+	}
+	if ln := len(g.Edges["b"]); ln != 1 {
+		t.Error("Expected the edges of b/sub to be on b, got:", g.Edges["b"])
+	}
+	if cycles := g.Cycles(); len(cycles) != 0 {
+		t.Error("Expected no cycles, got:", cycles)
+	}
+}
+
+func TestGraph_Cycles(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.0.0": {"b"}},
+		"b": {"1.0.0": {"c"}},
+		"c": {"1.0.0": {"a", "d"}},
+		"d": {"1.0.0": {"app"}},
+	}
+	r, err := Resolve(testRoot(t, "a"), "", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	g := NewGraph(r)
+	cycles, err := g.CheckCycles(CyclesWarn)
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	var exp = []string{
+		"app -> a -> b -> c -> d -> app",
+		"a -> b -> c -> a",
+	}
+	if len(cycles) != len(exp) {
+		t.Fatal("Unexpected cycles:", cycles)
+	}
+	found := make(map[string]bool)
+	for _, cycle := range cycles {
+		found[cycle.String()] = true
+	}
+	for _, e := range exp {
+		if !found[e] {
+			t.Errorf("Expected cycle: %s, got: %v", e, cycles)
+		}
+	}
+
+	_, err = g.CheckCycles(CyclesError)
+	cycleErr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatal("Expected a cycle error, got:", err)
+	}
+	if len(cycleErr.Cycles) != 2 ||
+		!strings.Contains(cycleErr.Error(), "a -> b -> c -> a") {
+
+		t.Error("Unexpected error:", cycleErr)
+	}
+}
+
+func TestGraph_CyclesShared(t *T) {
+	t.Parallel()
+
+	// The shortcut a -> c makes a second loop through a and c that a search
+	// which stops at visited packages never sees.
+	source := testSource{
+		"a": {"1.0.0": {"b", "c"}},
+		"b": {"1.0.0": {"c"}},
+		"c": {"1.0.0": {"a"}},
+	}
+	r, err := Resolve(testRoot(t, "a"), "", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	cycles := NewGraph(r).Cycles()
+	found := make(map[string]bool)
+	for _, cycle := range cycles {
+		found[cycle.String()] = true
+	}
+	if len(cycles) != 2 || !found["a -> b -> c -> a"] || !found["a -> c -> a"] {
+		t.Error("Expected both loops through a, got:", cycles)
+	}
+}
+
+func TestGraph_SubpackageCycle(t *T) {
+	t.Parallel()
+
+	source := NewMemorySource()
+	v, _ := ParseVersion("1.0.0")
+	source.Add("a", v, &Pack{
+		ImportPath:   "a",
+		Subpackages:  []string{"sub"},
+		Dependencies: []*Dependency{{Name: "b"}},
+	})
+	source.Add("b", v, &Pack{
+		ImportPath:   "b",
+		Dependencies: []*Dependency{{Name: "a/sub"}},
+	})
+	source.Add("a/sub", v, &Pack{ImportPath: "a"})
+
+	r, err := Resolve(testRoot(t, "a"), "", source)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	cycles := NewGraph(r).Cycles()
+	if len(cycles) != 1 || cycles[0].String() != "a -> b -> a/sub" {
+		t.Error("Expected a cycle through a/sub, got:", cycles)
+	}
+}
@@ -0,0 +1,147 @@
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// TreeHashPrefix prefixes every tree hash, it names the hash algorithm.
+	// It differs from the h1: of go.sum as the hashed lines are not the same.
+	TreeHashPrefix = "pack1:"
+)
+
+var (
+	// vcsDirs are the version control metadata directories that are not
+	// considered part of a tree.
+	vcsDirs = map[string]bool{
+		".git": true,
+		".hg":  true,
+		".bzr": true,
+		".svn": true,
+	}
+)
+
+// FileDigest is the hex encoded sha256 of a file's contents, Path is slash
+// separated and relative to the root of the tree. Link is set when the file
+// is a symbolic link, its digest is then that of the link's target path.
+type FileDigest struct {
+	Path   string
+	Digest string
+	Link   bool
+}
+
+// TreeHash is the hash of a directory tree along with the digests of every
+// file that was hashed, sorted by path.
+type TreeHash struct {
+	Sum   string
+	Files []FileDigest
+}
+
+// HashTree computes a stable hash of the contents of a directory in the form
+// pack1:base64. Version control metadata, file modes and directory entries do
+// not affect the hash, only the relative path and contents of each file.
+func HashTree(dir string) (string, error) {
+	tree, err := HashTreeFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	return tree.Sum, nil
+}
+
+// HashTreeFiles is like HashTree but also reports the digest of each file.
+//
+// The hash is the sha256 of one line per file in sorted path order:
+//
+//	<hex sha256 of contents>  <type>  <path>\n
+//
+// Where type is file for regular files and link for symbolic links. Links
+// are not followed, the digest of a link is that of its target path.
+func HashTreeFiles(dir string) (*TreeHash, error) {
+	tree := &TreeHash{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && vcsDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.Contains(rel, "\n") {
+			return fmt.Errorf("pack: [%s] filenames must not contain newlines",
+				rel)
+		}
+
+		var digest string
+		var link bool
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256([]byte(filepath.ToSlash(target)))
+			digest = hex.EncodeToString(sum[:])
+			link = true
+		case info.Mode().IsRegular():
+			if digest, err = hashFile(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		tree.Files = append(tree.Files, FileDigest{rel, digest, link})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tree.Files, func(i, j int) bool {
+		return tree.Files[i].Path < tree.Files[j].Path
+	})
+
+	h := sha256.New()
+	for _, f := range tree.Files {
+		kind := "file"
+		if f.Link {
+			kind = "link"
+		}
+		fmt.Fprintf(h, "%s  %s  %s\n", f.Digest, kind, f.Path)
+	}
+	tree.Sum = TreeHashPrefix + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return tree, nil
+}
+
+// hashFile returns the hex encoded sha256 of a file's contents.
+func hashFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,138 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+)
+
+func writeTestTree(t *T, dir string, files map[string]string) {
+	for name, contents := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0770); err != nil {
+			t.Fatal("Could not create dir:", err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0660); err != nil {
+			t.Fatal("Could not write file:", err)
+		}
+	}
+}
+
+func TestHashTree(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackhash")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeTestTree(t, a, map[string]string{
+		"pack.yaml":  "name: package\n",
+		"sub/sub.go": "package sub\n",
+		".git/HEAD":  "ref: refs/heads/master\n",
+	})
+	writeTestTree(t, b, map[string]string{
+		"sub/sub.go":   "package sub\n",
+		"pack.yaml":    "name: package\n",
+		".hg/dirstate": "whatever",
+	})
+	if err = os.Chmod(filepath.Join(b, "pack.yaml"), 0600); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	hashA, err := HashTree(a)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	hashB, err := HashTree(b)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !strings.HasPrefix(hashA, TreeHashPrefix) {
+		t.Error("Expected the hash prefix, got:", hashA)
+	}
+	if hashA != hashB {
+		t.Error("Expected equal trees to hash the same:", hashA, hashB)
+	}
+
+	writeTestTree(t, b, map[string]string{"sub/sub.go": "package changed\n"})
+	if hashB, err = HashTree(b); err != nil {
+		t.Fatal("Unexpected error:", err)
+	} else if hashA == hashB {
+		t.Error("Expected different contents to hash differently.")
+	}
+
+	tree, err := HashTreeFiles(a)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if tree.Sum != hashA {
+		t.Error("Expected the same sum, got:", tree.Sum)
+	}
+	if ln := len(tree.Files); ln != 2 {
+		t.Fatal("Expected 2 files, got:", tree.Files)
+	}
+	if f := tree.Files[1]; f.Path != "sub/sub.go" || len(f.Digest) != 64 {
+		t.Error("Unexpected file digest:", f)
+	}
+
+	if _, err = HashTree(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory.")
+	}
+}
+
+func TestHashTree_Known(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackhash")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An empty tree is the hash of no lines.
+	hash, err := HashTree(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	exp := "pack1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	if hash != exp {
+		t.Error("Expected:", exp, "got:", hash)
+	}
+}
+
+func TestHashTree_Symlink(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackhash")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeTestTree(t, a, map[string]string{"target": "x", "name": "target"})
+	writeTestTree(t, b, map[string]string{"target": "x"})
+	if err = os.Symlink("target", filepath.Join(b, "name")); err != nil {
+		t.Skip("Could not create symlink:", err)
+	}
+
+	hashA, err := HashTree(a)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	tree, err := HashTreeFiles(b)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if hashA == tree.Sum {
+		t.Error("Expected a link and a file with its target to differ.")
+	}
+	if f := tree.Files[0]; f.Path != "name" || !f.Link {
+		t.Error("Expected the link to be marked, got:", f)
+	}
+}
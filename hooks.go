@@ -0,0 +1,168 @@
+package pack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Defines the lifecycle stages that hooks can be run at.
+const (
+	// HookPreinstall runs before the package is installed.
+	HookPreinstall = "preinstall"
+	// HookPostinstall runs after the package has been checked out.
+	HookPostinstall = "postinstall"
+	// HookPretest runs before the package's tests are run.
+	HookPretest = "pretest"
+	// HookPrepublish runs before the package is published.
+	HookPrepublish = "prepublish"
+
+	errFmtHookStage = `pack: [%v] hook stage must be one of: ` +
+		`preinstall postinstall pretest prepublish`
+	errFmtHook = `pack: %s hook [%s] failed: %v`
+)
+
+var (
+	errHookTimeout = errors.New(`pack: Hook timed out.`)
+
+	// hookStages are all the stages in lifecycle order.
+	hookStages = []string{
+		HookPreinstall, HookPostinstall, HookPretest, HookPrepublish,
+	}
+)
+
+// Hooks are the commands to run at each stage of a package's lifecycle. Each
+// command is run by the system shell in the package directory.
+type Hooks struct {
+	Preinstall  []string `yaml:",omitempty"`
+	Postinstall []string `yaml:",omitempty"`
+	Pretest     []string `yaml:",omitempty"`
+	Prepublish  []string `yaml:",omitempty"`
+}
+
+// Commands returns the commands for a stage.
+func (h *Hooks) Commands(stage string) ([]string, error) {
+	switch stage {
+	case HookPreinstall:
+		return h.Preinstall, nil
+	case HookPostinstall:
+		return h.Postinstall, nil
+	case HookPretest:
+		return h.Pretest, nil
+	case HookPrepublish:
+		return h.Prepublish, nil
+	}
+	return nil, fmt.Errorf(errFmtHookStage, stage)
+}
+
+// HookResult is the outcome of running a single hook command.
+type HookResult struct {
+	Stage    string
+	Command  string
+	Dir      string
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	Duration time.Duration
+	TimedOut bool
+	// Err is set if the command could not be run, did not exit successfully
+	// or timed out.
+	Err error
+}
+
+// HookRunner runs the hooks of a package.
+type HookRunner struct {
+	// Paths supplies the GOPATH the hooks are run with, the packset's
+	// CombinedPath. If nil the current environment's GOPATH is used.
+	Paths *Paths
+	// Timeout is how long each command may run, zero means no limit.
+	Timeout time.Duration
+	// Env is added to the environment of each command.
+	Env []string
+}
+
+// Run runs the pack's hooks for the stage in dir, in order. It stops at the
+// first command that fails and returns the results of every command that was
+// run along with the error.
+func (r *HookRunner) Run(p *Pack, dir, stage string) ([]*HookResult, error) {
+	hooks := p.Hooks
+	if hooks == nil {
+		hooks = &Hooks{}
+	}
+
+	commands, err := hooks.Commands(stage)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*HookResult, 0, len(commands))
+	for _, command := range commands {
+		result := r.runCommand(stage, command, dir)
+		results = append(results, result)
+		if result.Err != nil {
+			return results, fmt.Errorf(errFmtHook, stage, command, result.Err)
+		}
+	}
+	return results, nil
+}
+
+// runCommand runs a single hook command and records the result.
+func (r *HookRunner) runCommand(stage, command, dir string) *HookResult {
+	result := &HookResult{Stage: stage, Command: command, Dir: dir}
+
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = dir
+	cmd.Env = r.environ()
+
+	start := time.Now()
+	stdout, stderr, err := captureCommand(ctx, cmd)
+	result.Duration = time.Since(start)
+	result.Stdout = stdout
+	result.Stderr = stderr
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result.TimedOut = true
+		result.Err = errHookTimeout
+	} else if cmdErr, ok := err.(*CommandError); ok {
+		// The hook's error already names the command.
+		result.Err = cmdErr.Err
+	}
+	return result
+}
+
+// environ builds the environment for a hook command.
+func (r *HookRunner) environ() []string {
+	env := os.Environ()
+	if r.Paths != nil {
+		prefix := GOPATH + "="
+		for i := 0; i < len(env); {
+			if strings.HasPrefix(env[i], prefix) {
+				env = append(env[:i], env[i+1:]...)
+			} else {
+				i++
+			}
+		}
+		env = append(env, prefix+r.Paths.CombinedPath)
+	}
+	return append(env, r.Env...)
+}
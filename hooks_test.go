@@ -0,0 +1,126 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	. "testing"
+	"time"
+)
+
+func TestHooks_Commands(t *T) {
+	t.Parallel()
+
+	h := &Hooks{Postinstall: []string{"go generate ./..."}}
+	for _, stage := range hookStages {
+		commands, err := h.Commands(stage)
+		if err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		if stage == HookPostinstall && len(commands) != 1 {
+			t.Error("Expected a postinstall command, got:", commands)
+		}
+	}
+	if _, err := h.Commands("postpublish"); err == nil {
+		t.Error("Expected an error for an unknown stage.")
+	}
+}
+
+func TestPack_HooksYAML(t *T) {
+	t.Parallel()
+
+	p := mustParsePack(t, `hooks:
+  postinstall:
+  - go generate ./...
+  pretest:
+  - echo one
+  - echo two
+`)
+	if p.Hooks == nil || len(p.Hooks.Postinstall) != 1 ||
+		len(p.Hooks.Pretest) != 2 {
+
+		t.Error("Unexpected hooks:", p.Hooks)
+	}
+	if len(p.Extensions) != 0 {
+		t.Error("Hooks should not be extensions:", p.Extensions)
+	}
+}
+
+func TestHookRunner_Run(t *T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackhooks")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths, err := NewPaths(fakeGoPath, fakePackset)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	p := &Pack{Hooks: &Hooks{
+		Pretest: []string{
+			`echo "$GOPATH"`,
+			`pwd`,
+			`echo bad >&2; exit 3`,
+			`echo never`,
+		},
+	}}
+
+	r := &HookRunner{Paths: paths}
+	results, err := r.Run(p, dir, HookPretest)
+	if err == nil {
+		t.Error("Expected an error from the failing hook.")
+	}
+	if ln := len(results); ln != 3 {
+		t.Fatal("Expected 3 results, got:", ln)
+	}
+
+	out := strings.TrimSpace(string(results[0].Stdout))
+	if out != paths.CombinedPath {
+		t.Errorf("Expected GOPATH: %s, got: %s", paths.CombinedPath, out)
+	}
+	realDir, _ := filepath.EvalSymlinks(dir)
+	if out = strings.TrimSpace(string(results[1].Stdout)); out != realDir {
+		t.Error("Expected the hook to run in:", realDir, "got:", out)
+	}
+	if r := results[2]; r.ExitCode != 3 || string(r.Stderr) != "bad\n" ||
+		r.Err == nil {
+
+		t.Error("Expected the failure to be captured, got:", r)
+	}
+
+	results, err = r.Run(&Pack{}, dir, HookPrepublish)
+	if err != nil || len(results) != 0 {
+		t.Error("Expected no results and no error, got:", results, err)
+	}
+	if _, err = r.Run(&Pack{}, dir, "nope"); err == nil {
+		t.Error("Expected an error for an unknown stage.")
+	}
+}
+
+func TestHookRunner_Timeout(t *T) {
+	if runtime.GOOS == "windows" || Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	p := &Pack{Hooks: &Hooks{Preinstall: []string{"sleep 5"}}}
+	r := &HookRunner{Timeout: 50 * time.Millisecond}
+	results, err := r.Run(p, os.TempDir(), HookPreinstall)
+	if err == nil {
+		t.Error("Expected a timeout error.")
+	}
+	if len(results) != 1 || !results[0].TimedOut {
+		t.Error("Expected the hook to time out, got:", results)
+	} else if results[0].Duration > 4*time.Second {
+		t.Error("The hook was not killed, took:", results[0].Duration)
+	}
+}
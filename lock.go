@@ -0,0 +1,429 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// LOCKFILE is the name of the lock file in the root of a package.
+	LOCKFILE = "pack.lock"
+
+	errFmtNoTag       = `pack: [%v@%v] no tag for version`
+	errFmtNoRevision  = `pack: [%v] repository cannot identify revisions`
+	errFmtNoURL       = `pack: [%v] lock file has no url to clone from`
+	errFmtNotAtTag    = `pack: [%v] working copy is at %q, not tag %v`
+	errFmtNotLocked   = `pack: [%v] environment is not locked`
+	errFmtTreeHash    = `pack: [%v] tree hash is %v, lock file expects %v`
+	errMsgLockVerify  = `pack: lock file does not match the pack: `
+	errMsgLockMissing = `is not locked`
+)
+
+// LockedDependency is the exact state of a resolved dependency.
+type LockedDependency struct {
+	// ImportPath is the import path of the dependency.
+	ImportPath string
+	// Root is the import path of the repository the dependency is in, it is
+	// empty when that is ImportPath.
+	Root string `yaml:",omitempty"`
+	// Version is the resolved version.
+	Version *Version
+	// Tag is the repository tag of Version.
+	Tag string
+	// VCS is the type of the repository, one of the Repository.Type values.
+	VCS string `yaml:"vcs"`
+	// URL is where the repository is cloned from.
+	URL string `yaml:",omitempty"`
+	// Revision is the exact revision of Tag as given by the repository's
+	// Revisioner, a commit hash or, for subversion, the tag at a peg revision.
+	Revision string
+	// TreeHash is the HashTree of the repository at Revision.
+	TreeHash string `yaml:",omitempty"`
+}
+
+// RootPath returns the import path of the dependency's repository.
+func (d *LockedDependency) RootPath() string {
+	if len(d.Root) > 0 {
+		return d.Root
+	}
+	return d.ImportPath
+}
+
+// PackLock records the resolved state of a pack's dependencies so that they
+// can be installed again exactly, without resolving. Each environment holds
+// the complete resolution of that environment.
+type PackLock struct {
+	// Dependencies is the resolution without an environment.
+	Dependencies []*LockedDependency `yaml:",omitempty"`
+	// Environments is the resolution of each environment.
+	Environments map[string][]*LockedDependency `yaml:",omitempty"`
+}
+
+// ParsePackLock parses a lock file.
+func ParsePackLock(reader io.Reader) (*PackLock, error) {
+	read, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	l := new(PackLock)
+	if err = goyaml.Unmarshal(read, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ParsePackLockFile opens a file for reading and parses it into a PackLock.
+func ParsePackLockFile(filename string) (*PackLock, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParsePackLock(file)
+}
+
+// Write writes the lock file to the writer.
+func (l *PackLock) Write(writer io.Writer) error {
+	written, err := goyaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	n, err := writer.Write(written)
+	if err != nil {
+		return err
+	}
+	if n != len(written) {
+		return errPartialWrite
+	}
+	return nil
+}
+
+// WritePackLockFile writes the lock file atomically in the same way as
+// WritePackFile.
+func (l *PackLock) WritePackLockFile(filename string) error {
+	return writeFileAtomic(filename, l.Write)
+}
+
+// Locked returns the locked dependencies of an environment.
+func (l *PackLock) Locked(env string) []*LockedDependency {
+	if len(env) == 0 {
+		return l.Dependencies
+	}
+	return l.Environments[env]
+}
+
+// Find returns the locked dependency by import path in an environment, or
+// nil if it is not locked.
+func (l *PackLock) Find(env, name string) *LockedDependency {
+	for _, d := range l.Locked(env) {
+		if d.ImportPath == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Set replaces the locked dependencies of an environment, they are kept
+// sorted by import path.
+func (l *PackLock) Set(env string, deps []*LockedDependency) {
+	sorted := make([]*LockedDependency, len(deps))
+	copy(sorted, deps)
+	sort.Sort(lockedByPath(sorted))
+
+	if len(env) == 0 {
+		l.Dependencies = sorted
+		return
+	}
+	if l.Environments == nil {
+		l.Environments = make(map[string][]*LockedDependency)
+	}
+	l.Environments[env] = sorted
+}
+
+// Lock records a resolution in the lock file under its environment. Each
+// dependency is locked from its repository in the paths with LockRepository.
+// The URL and VCS are from the first url given by a requirement on the
+// dependency, or else the repository of its pack. When neither gives a url,
+// or the url only gives the type, it is cloned over https from the import
+// path of the repository.
+func (l *PackLock) Lock(ctx context.Context, r *Resolution,
+	paths *Paths) error {
+
+	deps := make([]*LockedDependency, 0, len(r.Versions))
+	for _, name := range r.Names() {
+		d, err := LockRepository(ctx, paths, name, r.Versions[name])
+		if err != nil {
+			return err
+		}
+		resolvedURL(r, d)
+		deps = append(deps, d)
+	}
+	l.Set(r.Environment, deps)
+	return nil
+}
+
+// resolvedURL sets the URL and VCS of a resolved dependency.
+func resolvedURL(r *Resolution, d *LockedDependency) {
+	d.URL = ""
+	found := false
+	for _, req := range r.Requirements {
+		dep := req.Dependency
+		if dep.Name != d.ImportPath || len(dep.URL) == 0 {
+			continue
+		}
+		vcs, url := dep.CloneURL()
+		if len(vcs) > 0 {
+			d.VCS = vcs
+		}
+		d.URL = url
+		found = true
+		break
+	}
+	if p := r.Packs[d.ImportPath]; !found && p != nil && p.Repository != nil {
+		if len(p.Repository.Type) > 0 {
+			d.VCS = p.Repository.Type
+		}
+		d.URL = p.Repository.URL
+	}
+	if len(d.URL) == 0 {
+		d.URL = "https://" + d.RootPath()
+	}
+}
+
+// LockRepository creates the locked state of a package at a version. The
+// package's repository is found in the paths as described by PathsOpener and
+// its working copy must be checked out at the version's tag, as the tree hash
+// is computed from it, otherwise an error is returned. The URL is left for
+// the caller to fill in.
+func LockRepository(ctx context.Context, paths *Paths, name string,
+	version *Version) (*LockedDependency, error) {
+
+	dvcs, dir, root, err := findRepository(paths, name)
+	if err != nil {
+		return nil, err
+	}
+	cdvcs := withContext(dvcs)
+
+	tags, err := cdvcs.TagsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tag string
+	for _, t := range tags {
+		if v, err := ParseVersion(t); err == nil && v.Compare(version) == 0 {
+			tag = t
+			break
+		}
+	}
+	if len(tag) == 0 {
+		return nil, fmt.Errorf(errFmtNoTag, name, version)
+	}
+
+	current, err := cdvcs.CurrentTagContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current != tag {
+		return nil, fmt.Errorf(errFmtNotAtTag, name, current, tag)
+	}
+
+	revisioner, ok := dvcs.(Revisioner)
+	if !ok {
+		return nil, fmt.Errorf(errFmtNoRevision, name)
+	}
+	revision, err := revisioner.Revision(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := HashTree(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &LockedDependency{
+		ImportPath: name,
+		Version:    version,
+		Tag:        tag,
+		VCS:        DVCSType(dvcs),
+		Revision:   revision,
+		TreeHash:   hash,
+	}
+	if root != name {
+		d.Root = root
+	}
+	return d, nil
+}
+
+// LockMismatch is a dependency of a pack that its lock file does not
+// satisfy.
+type LockMismatch struct {
+	// Environment is the environment of the lock file that was checked.
+	Environment string
+	// Dependency is the dependency declared by the pack.
+	Dependency *Dependency
+	// Locked is the locked dependency, nil if it is not locked.
+	Locked *LockedDependency
+}
+
+// String describes the mismatch, ie. b >=2.0.0 is locked at 1.0.0 (test)
+func (m *LockMismatch) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(m.Dependency.Name)
+	if len(m.Dependency.Constraints) > 0 {
+		buf.WriteByte(' ')
+		buf.WriteString(m.Dependency.Constraints.String())
+	}
+	buf.WriteByte(' ')
+	if m.Locked == nil || m.Locked.Version == nil {
+		buf.WriteString(errMsgLockMissing)
+	} else {
+		fmt.Fprintf(&buf, "is locked at %v", m.Locked.Version)
+	}
+	if len(m.Environment) > 0 {
+		fmt.Fprintf(&buf, " (%s)", m.Environment)
+	}
+	return buf.String()
+}
+
+// LockError is returned when a lock file does not satisfy its pack.
+type LockError struct {
+	Mismatches []*LockMismatch
+}
+
+// Error implements the error interface.
+func (e *LockError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString(errMsgLockVerify)
+	for i, m := range e.Mismatches {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(m.String())
+	}
+	return buf.String()
+}
+
+// Verify checks that every dependency the pack declares is locked at a
+// version that satisfies its constraints, in the default environment and in
+// each locked environment. If any is not a *LockError is returned.
+func (l *PackLock) Verify(p *Pack) error {
+	envs := make([]string, 0, len(l.Environments)+1)
+	envs = append(envs, "")
+	for env := range l.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs[1:])
+
+	name := packName(p)
+	var mismatches []*LockMismatch
+	for _, env := range envs {
+		for _, dep := range p.EnvironmentDependencies(env) {
+			if dep.Name == name {
+				continue
+			}
+			locked := l.Find(env, dep.Name)
+			if locked != nil && locked.Version != nil &&
+				dep.Constraints.Satisfied(locked.Version) {
+
+				continue
+			}
+			mismatches = append(mismatches, &LockMismatch{env, dep, locked})
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &LockError{mismatches}
+	}
+	return nil
+}
+
+// Install installs every locked dependency of an environment into the
+// packset of the paths. Dependencies that share a repository are installed
+// once.
+func (l *PackLock) Install(ctx context.Context, paths *Paths,
+	env string) error {
+
+	if _, ok := l.Environments[env]; len(env) > 0 && !ok {
+		return fmt.Errorf(errFmtNotLocked, env)
+	}
+
+	installed := make(map[string]bool)
+	for _, d := range l.Locked(env) {
+		root := d.RootPath()
+		if installed[root] {
+			continue
+		}
+		installed[root] = true
+
+		dir := filepath.Join(paths.GopacksetPath, filepath.FromSlash(root))
+		if err := d.Install(ctx, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Install clones the dependency's repository into dir if it is not already
+// there, checks out the locked revision, updating the repository if it does
+// not have it yet, and verifies the tree hash. The version control commands
+// are stopped when ctx is done.
+func (d *LockedDependency) Install(ctx context.Context, dir string) error {
+	if len(d.URL) == 0 {
+		return fmt.Errorf(errFmtNoURL, d.ImportPath)
+	}
+	dvcs, err := NewDVCS(d.VCS, dir)
+	if err != nil {
+		return err
+	}
+	cdvcs := withContext(dvcs)
+	if err = cdvcs.CloneContext(ctx, d.URL); err != nil {
+		return err
+	}
+	if err = cdvcs.CheckoutContext(ctx, d.Revision); err != nil {
+		if isContextErr(err) {
+			return err
+		}
+		if err = cdvcs.UpdateContext(ctx); err != nil {
+			return err
+		}
+		if err = cdvcs.CheckoutContext(ctx, d.Revision); err != nil {
+			return err
+		}
+	}
+	return d.VerifyTree(dir)
+}
+
+// VerifyTree checks that the tree hash of dir is the locked tree hash. A
+// dependency without a tree hash is not checked.
+func (d *LockedDependency) VerifyTree(dir string) error {
+	if len(d.TreeHash) == 0 {
+		return nil
+	}
+	hash, err := HashTree(dir)
+	if err != nil {
+		return err
+	}
+	if hash != d.TreeHash {
+		return fmt.Errorf(errFmtTreeHash, d.ImportPath, hash, d.TreeHash)
+	}
+	return nil
+}
+
+// lockedByPath sorts locked dependencies by import path.
+type lockedByPath []*LockedDependency
+
+func (l lockedByPath) Len() int      { return len(l) }
+func (l lockedByPath) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l lockedByPath) Less(i, j int) bool {
+	return l[i].ImportPath < l[j].ImportPath
+}
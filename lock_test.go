@@ -0,0 +1,357 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+)
+
+var testLock = `dependencies:
+  - importpath: host/a/sub
+    root: host/a
+    version: 1.1.0
+    tag: 1.1.0
+    vcs: git
+    url: https://host/a
+    revision: 0123456789abcdef
+    treehash: pack1:abc=
+environments:
+  test:
+    - importpath: host/a/sub
+      version: 1.0.0
+      tag: 1.0.0
+      vcs: git
+      revision: fedcba9876543210
+`
+
+func TestParsePackLock(t *T) {
+	t.Parallel()
+
+	l, err := ParsePackLock(strings.NewReader(testLock))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	d := l.Find("", "host/a/sub")
+	if d == nil {
+		t.Fatal("Expected host/a/sub to be locked.")
+	}
+	if d.RootPath() != "host/a" || d.Version.String() != "1.1.0" ||
+		d.Tag != "1.1.0" || d.VCS != VCSGit || d.URL != "https://host/a" ||
+		d.Revision != "0123456789abcdef" || d.TreeHash != "pack1:abc=" {
+
+		t.Errorf("Unexpected locked dependency: %#v", d)
+	}
+	if d = l.Find("test", "host/a/sub"); d == nil {
+		t.Fatal("Expected host/a/sub to be locked in test.")
+	} else if d.RootPath() != "host/a/sub" || d.Version.String() != "1.0.0" {
+		t.Errorf("Unexpected locked dependency: %#v", d)
+	}
+	if l.Find("prod", "host/a/sub") != nil {
+		t.Error("Expected nothing to be locked in prod.")
+	}
+
+	var buf bytes.Buffer
+	if err = l.Write(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	reparsed, err := ParsePackLock(&buf)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if d = reparsed.Find("test", "host/a/sub"); d == nil ||
+		d.Revision != "fedcba9876543210" {
+
+		t.Error("Expected the lock file to round trip, got:", reparsed)
+	}
+}
+
+func TestPackLock_Set(t *T) {
+	t.Parallel()
+
+	l := &PackLock{}
+	l.Set("test", []*LockedDependency{{ImportPath: "b"}, {ImportPath: "a"}})
+	if locked := l.Locked("test"); len(locked) != 2 ||
+		locked[0].ImportPath != "a" {
+
+		t.Error("Expected sorted dependencies, got:", locked)
+	}
+	if len(l.Locked("")) != 0 {
+		t.Error("Expected no default dependencies.")
+	}
+}
+
+func TestPackLock_Verify(t *T) {
+	t.Parallel()
+
+	v1, _ := ParseVersion("1.0.0")
+	v2, _ := ParseVersion("2.0.0")
+	l := &PackLock{}
+	l.Set("", []*LockedDependency{
+		{ImportPath: "a", Version: v1},
+		{ImportPath: "b", Version: v2},
+	})
+	l.Set("test", []*LockedDependency{
+		{ImportPath: "a", Version: v1},
+		{ImportPath: "b", Version: v2},
+	})
+
+	p := testRoot(t, "a ~1.0.0", "b", "app")
+	if err := l.Verify(p); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	p = testRoot(t, "a >=2.0.0", "b")
+	p.Environments = map[string][]*Dependency{"test": {{Name: "c"}}}
+	err := l.Verify(p)
+	lockErr, ok := err.(*LockError)
+	if !ok {
+		t.Fatal("Expected a lock error, got:", err)
+	}
+	if ln := len(lockErr.Mismatches); ln != 3 {
+		t.Fatal("Expected 3 mismatches, got:", lockErr.Mismatches)
+	}
+	var exp = []string{
+		"a >=2.0.0 is locked at 1.0.0",
+		"a >=2.0.0 is locked at 1.0.0 (test)",
+		"c is not locked (test)",
+	}
+	for i, e := range exp {
+		if got := lockErr.Mismatches[i].String(); got != e {
+			t.Errorf("Expected: %q, got: %q", e, got)
+		}
+	}
+}
+
+func TestPackLock_Install(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopacklock")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	origin := filepath.Join(dir, "origin")
+	repo := filepath.Join(origin, "src", "host", "a")
+	if err = os.MkdirAll(filepath.Join(repo, "sub"), 0770); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	gitTestRepo(t, repo)
+
+	paths, err := NewPaths(origin, "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	dep, err := ParseDependency("host/a/sub git:" + repo)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	v, _ := ParseVersion("1.1.0")
+	r := &Resolution{
+		Root:     testRoot(t),
+		Versions: map[string]*Version{"host/a/sub": v},
+		Packs:    map[string]*Pack{"host/a/sub": {}},
+		Requirements: []*Requirement{{
+			From:       "app",
+			Dependency: dep,
+		}},
+	}
+
+	l := &PackLock{}
+	if err = l.Lock(context.Background(), r, paths); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	d := l.Find("", "host/a/sub")
+	if d == nil {
+		t.Fatal("Expected host/a/sub to be locked.")
+	}
+	if d.Root != "host/a" || d.Tag != "1.1.0" || d.VCS != VCSGit ||
+		d.URL != repo || len(d.Revision) != 40 || len(d.TreeHash) == 0 {
+
+		t.Errorf("Unexpected locked dependency: %#v", d)
+	}
+
+	filename := filepath.Join(dir, LOCKFILE)
+	if err = l.WritePackLockFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if l, err = ParsePackLockFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	install, err := NewPaths(filepath.Join(dir, "install"), "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = l.Install(context.Background(), install, ""); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	installed := filepath.Join(install.GopacksetPath, "host", "a", PACKFILE)
+	if _, err = os.Stat(installed); err != nil {
+		t.Error("Expected the repository to be installed:", err)
+	}
+
+	if err = l.Install(context.Background(), install, "test"); err == nil {
+		t.Error("Expected an error for an environment that is not locked.")
+	}
+
+	d = l.Find("", "host/a/sub")
+	d.TreeHash = "pack1:wrong"
+	err = d.VerifyTree(filepath.Join(install.GopacksetPath, "host", "a"))
+	if err == nil {
+		t.Error("Expected a tree hash error.")
+	}
+}
+
+func TestLockRepository_NotAtTag(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopacklock")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "src", "host", "a")
+	if err = os.MkdirAll(repo, 0770); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	gitTestRepo(t, repo)
+	if err = NewGit(repo).Checkout("1.0.0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	paths, err := NewPaths(dir, "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	v, _ := ParseVersion("1.1.0")
+	_, err = LockRepository(context.Background(), paths, "host/a", v)
+	if err == nil {
+		t.Error("Expected an error when the working copy is at another tag.")
+	}
+
+	v, _ = ParseVersion("1.0.0")
+	d, err := LockRepository(context.Background(), paths, "host/a", v)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if d.Tag != "1.0.0" {
+		t.Error("Unexpected tag:", d.Tag)
+	}
+
+	dep, _ := ParseDependency("host/a git")
+	r := &Resolution{Requirements: []*Requirement{{Dependency: dep}}}
+	d.VCS = ""
+	resolvedURL(r, d)
+	if d.VCS != VCSGit || d.URL != "https://host/a" {
+		t.Errorf("Unexpected url: %s %s", d.VCS, d.URL)
+	}
+	r = &Resolution{}
+	d.URL = ""
+	resolvedURL(r, d)
+	if d.URL != "https://host/a" {
+		t.Error("Expected the import path to be cloned, got:", d.URL)
+	}
+
+	d.URL = ""
+	if err = d.Install(context.Background(), dir); err == nil {
+		t.Error("Expected an error installing without a url.")
+	}
+}
+
+func TestPackLock_InstallSvn(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	for _, tool := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool, "is not installed.")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gopacklock")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	url := svnTestRepo(t, dir)
+
+	origin := filepath.Join(dir, "origin")
+	repo := filepath.Join(origin, "src", "host", "a")
+	svn := NewSvn(repo)
+	if err = svn.Clone(url); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = svn.Checkout("1.0.0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	paths, err := NewPaths(origin, "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	dep, err := ParseDependency("host/a svn:" + url)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	v, _ := ParseVersion("1.0.0")
+	r := &Resolution{
+		Root:         testRoot(t),
+		Versions:     map[string]*Version{"host/a": v},
+		Packs:        map[string]*Pack{"host/a": {}},
+		Requirements: []*Requirement{{From: "app", Dependency: dep}},
+	}
+
+	l := &PackLock{}
+	if err = l.Lock(context.Background(), r, paths); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	d := l.Find("", "host/a")
+	if d == nil {
+		t.Fatal("Expected host/a to be locked.")
+	}
+	if d.VCS != VCSSubversion || d.URL != url || d.Tag != "1.0.0" ||
+		d.Revision != "tags/1.0.0@3" || len(d.TreeHash) == 0 {
+
+		t.Errorf("Unexpected locked dependency: %#v", d)
+	}
+
+	filename := filepath.Join(dir, LOCKFILE)
+	if err = l.WritePackLockFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if l, err = ParsePackLockFile(filename); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	install, err := NewPaths(filepath.Join(dir, "install"), "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = l.Install(context.Background(), install, ""); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	installed := filepath.Join(install.GopacksetPath, "host", "a",
+		"README.txt")
+	if read, err := ioutil.ReadFile(installed); err != nil ||
+		string(read) != "1.0.0" {
+
+		t.Error("Expected the locked tree to be installed:", string(read), err)
+	}
+}
@@ -0,0 +1,173 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// OutdatedDependency compares the version of a dependency that is checked out
+// to the versions that are available.
+type OutdatedDependency struct {
+	// Environment is the environment the dependency is declared in, empty for
+	// the default Dependencies.
+	Environment string `json:"environment"`
+	Name        string `json:"name"`
+	Constraints string `json:"constraints"`
+	// Current is the tag that is checked out, empty when the working copy is
+	// not at a tag.
+	Current string `json:"current"`
+	// Allowed is the newest tag that satisfies the constraints.
+	Allowed string `json:"allowed"`
+	// Latest is the newest tag.
+	Latest string `json:"latest"`
+	// MajorJump is set when Latest has a newer major version than Current,
+	// or than Allowed when nothing is checked out.
+	MajorJump bool `json:"majorJump"`
+	// Error is why the repository could not be inspected.
+	Error string `json:"error,omitempty"`
+}
+
+// Outdated checks if the dependency is not checked out at its latest version.
+func (o *OutdatedDependency) Outdated() bool {
+	return len(o.Error) == 0 && o.Current != o.Latest
+}
+
+// OutdatedReport lists every dependency of a pack with its versions.
+type OutdatedReport struct {
+	Dependencies []*OutdatedDependency `json:"dependencies"`
+}
+
+// Outdated reports the versions of every dependency of the pack, in its
+// default Dependencies and then each environment. The repository of each
+// dependency is opened with open, PathsOpener can be used to find them in
+// the GOPATH. A dependency whose repository can't be inspected has its Error
+// set instead of failing the whole report.
+func (p *Pack) Outdated(open Opener) *OutdatedReport {
+	envs := make([]string, 0, len(p.Environments))
+	for env := range p.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	report := &OutdatedReport{Dependencies: []*OutdatedDependency{}}
+	add := func(env string, deps []*Dependency) {
+		for _, dep := range deps {
+			report.Dependencies = append(report.Dependencies,
+				outdatedDependency(env, dep, open))
+		}
+	}
+	add("", p.Dependencies)
+	for _, env := range envs {
+		add(env, p.Environments[env])
+	}
+	return report
+}
+
+// outdatedDependency inspects the repository of a single dependency.
+func outdatedDependency(env string, dep *Dependency,
+	open Opener) *OutdatedDependency {
+
+	o := &OutdatedDependency{
+		Environment: env,
+		Name:        dep.Name,
+		Constraints: dep.Constraints.String(),
+	}
+
+	dvcs, _, err := open(dep.Name)
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+	if o.Current, err = dvcs.CurrentTag(); err != nil {
+		o.Error = err.Error()
+		return o
+	}
+	tags, err := dvcs.Tags()
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+
+	var allowed, latest *Version
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil {
+			continue
+		}
+		if latest == nil || v.Compare(latest) > 0 {
+			latest = v
+			o.Latest = tag
+		}
+		if dep.Constraints.Satisfied(v) &&
+			(allowed == nil || v.Compare(allowed) > 0) {
+
+			allowed = v
+			o.Allowed = tag
+		}
+	}
+
+	base := allowed
+	if current, err := ParseVersion(o.Current); err == nil {
+		base = current
+	}
+	o.MajorJump = base != nil && latest != nil && latest.Major > base.Major
+	return o
+}
+
+// Outdated returns only the dependencies that are not at their latest
+// version.
+func (r *OutdatedReport) Outdated() []*OutdatedDependency {
+	var outdated []*OutdatedDependency
+	for _, o := range r.Dependencies {
+		if o.Outdated() {
+			outdated = append(outdated, o)
+		}
+	}
+	return outdated
+}
+
+// String renders the report as a plain text table. Major version jumps are
+// marked with a ! after the latest version.
+func (r *OutdatedReport) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tDEPENDENCY\tCONSTRAINTS\tCURRENT\tALLOWED\t"+
+		"LATEST")
+	for _, o := range r.Dependencies {
+		if len(o.Error) > 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\terror: %s\t\t\n",
+				environmentLabel(o.Environment), o.Name,
+				outdatedCell(o.Constraints), o.Error)
+			continue
+		}
+		latest := outdatedCell(o.Latest)
+		if o.MajorJump {
+			latest += " !"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			environmentLabel(o.Environment), o.Name,
+			outdatedCell(o.Constraints), outdatedCell(o.Current),
+			outdatedCell(o.Allowed), latest)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// WriteJSON writes the report to the writer as json.
+func (r *OutdatedReport) WriteJSON(writer io.Writer) error {
+	enc := json.NewEncoder(writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// outdatedCell makes an empty value visible in the table.
+func outdatedCell(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	. "testing"
+)
+
+// testDVCS is a DVCS with fixed tags.
+type testDVCS struct {
+	tags    []string
+	current string
+}
+
+func (d *testDVCS) Status() error                 { return nil }
+func (d *testDVCS) Clone(url string) error        { return nil }
+func (d *testDVCS) Update() error                 { return nil }
+func (d *testDVCS) Checkout(version string) error { return nil }
+func (d *testDVCS) Tags() ([]string, error)       { return d.tags, nil }
+func (d *testDVCS) CurrentTag() (string, error)   { return d.current, nil }
+func (d *testDVCS) SetRepoPath(path string)       {}
+
+func TestPack_Outdated(t *T) {
+	t.Parallel()
+
+	repos := map[string]*testDVCS{
+		"a": {[]string{"1.0.0", "1.2.0", "2.1.0", "junk"}, "1.0.0"},
+		"b": {[]string{"0.1.0", "0.2.0"}, "0.2.0"},
+		"c": {[]string{"1.0.0", "1.1.0"}, ""},
+	}
+	open := func(name string) (DVCS, string, error) {
+		if d, ok := repos[name]; ok {
+			return d, name, nil
+		}
+		return nil, "", errors.New("not installed")
+	}
+
+	p := testRoot(t, "a ~1.0.0", "b")
+	p.Environments = map[string][]*Dependency{
+		"test": {{Name: "c"}, {Name: "d"}},
+	}
+
+	report := p.Outdated(open)
+	if ln := len(report.Dependencies); ln != 4 {
+		t.Fatal("Expected 4 dependencies, got:", ln)
+	}
+
+	var tests = []OutdatedDependency{
+		{"", "a", "~1.0.0", "1.0.0", "1.2.0", "2.1.0", true, ""},
+		{"", "b", "", "0.2.0", "0.2.0", "0.2.0", false, ""},
+		{"test", "c", "", "", "1.1.0", "1.1.0", false, ""},
+		{"test", "d", "", "", "", "", false, "not installed"},
+	}
+	for i, test := range tests {
+		got := report.Dependencies[i]
+		if got.Name != test.Name || got.Environment != test.Environment {
+			t.Errorf("%d) expected %s, got: %s", i, test.Name, got.Name)
+			continue
+		}
+		if got.Constraints != test.Constraints ||
+			got.Current != test.Current || got.Allowed != test.Allowed ||
+			got.Latest != test.Latest || got.MajorJump != test.MajorJump ||
+			got.Error != test.Error {
+
+			t.Errorf("%s: expected: %#v, got: %#v", test.Name, test, *got)
+		}
+	}
+
+	outdated := report.Outdated()
+	if len(outdated) != 2 || outdated[0].Name != "a" ||
+		outdated[1].Name != "c" {
+
+		t.Error("Unexpected outdated dependencies:", outdated)
+	}
+
+	table := report.String()
+	if !strings.Contains(table, "LATEST") ||
+		!strings.Contains(table, "2.1.0 !") ||
+		!strings.Contains(table, "error: not installed") {
+
+		t.Errorf("Unexpected table:\n%s", table)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var decoded OutdatedReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(decoded.Dependencies) != 4 || !decoded.Dependencies[0].MajorJump {
+		t.Error("Unexpected json:", buf.String())
+	}
+}
@@ -0,0 +1,316 @@
+package pack
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// LOCALSUFFIX is inserted before the extension of a pack file to find
+	// its local override file, ie. pack.yaml -> pack.local.yaml
+	LOCALSUFFIX = ".local"
+
+	// LayerBase is the layer of values that came from the main pack file.
+	LayerBase = "base"
+	// LayerLocal is the layer of values that came from the override file.
+	LayerLocal = "local"
+)
+
+// LayeredPack is a Pack with a local override merged over it. The embedded
+// Pack holds the effective values.
+//
+// The merge rules are:
+//
+// Scalar fields (Name, ImportPath, Version, Summary, Description, Homepage,
+// License) and each field of Repository and Support are replaced when they
+// are set in the override.
+//
+// Authors, Contributors and Subpackages are replaced as a whole when the
+// override's list is not empty.
+//
+// Dependencies are merged by name. A dependency in the override replaces the
+// base dependency of the same name (constraints and url) and keeps its
+// position, new dependencies are appended.
+//
+// Environments are merged by environment name, and the dependencies within an
+// environment are merged the same way as Dependencies.
+//
+// Toolchain is merged field by field, the go constraints and each list of
+// tags are replaced when they are set in the override.
+//
+// Hooks are merged by stage, a stage with commands in the override replaces
+// the base stage's commands.
+//
+// Extensions are merged by key, an extension in the override replaces the
+// base extension as a whole.
+type LayeredPack struct {
+	*Pack
+	// Base is the pack as read from the main file.
+	Base *Pack
+	// Local is the override pack, nil if there was none.
+	Local *Pack
+
+	origins map[string]string
+}
+
+// LocalPackFilename returns the name of the override file for a pack file.
+func LocalPackFilename(filename string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + LOCALSUFFIX + ext
+}
+
+// ParseLayeredPackFile parses the pack file and merges the override file
+// next to it over the top if it exists.
+func ParseLayeredPackFile(filename string) (*LayeredPack, error) {
+	base, err := ParsePackFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	localname := LocalPackFilename(filename)
+	exists, err := FileExists(localname)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return MergePacks(base, nil), nil
+	}
+
+	local, err := ParsePackFile(localname)
+	if err != nil {
+		return nil, err
+	}
+	return MergePacks(base, local), nil
+}
+
+// LoadPackFile parses the pack file with its local override merged over it.
+// The result must not be written back to the main pack file since it
+// contains the local values.
+func LoadPackFile(filename string) (*Pack, error) {
+	l, err := ParseLayeredPackFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return l.Pack, nil
+}
+
+// MergePacks merges the override over the base according to the rules
+// documented on LayeredPack. Neither argument is modified, the override may be
+// nil.
+func MergePacks(base, override *Pack) *LayeredPack {
+	l := &LayeredPack{
+		Pack:    new(Pack),
+		Base:    base,
+		Local:   override,
+		origins: make(map[string]string),
+	}
+	*l.Pack = *base
+	l.setOrigins(base, LayerBase)
+	if override == nil {
+		return l
+	}
+
+	p := l.Pack
+	l.mergeString("name", &p.Name, override.Name)
+	l.mergeString("importpath", &p.ImportPath, override.ImportPath)
+	if override.Version != nil {
+		v := *override.Version
+		p.Version = &v
+		l.origins["version"] = LayerLocal
+	}
+	l.mergeString("summary", &p.Summary, override.Summary)
+	l.mergeString("description", &p.Description, override.Description)
+	l.mergeString("homepage", &p.Homepage, override.Homepage)
+	l.mergeString("license", &p.License, override.License)
+
+	if override.Repository != nil {
+		repo := new(Repository)
+		if p.Repository != nil {
+			*repo = *p.Repository
+		}
+		l.mergeString("repository.type", &repo.Type, override.Repository.Type)
+		l.mergeString("repository.url", &repo.URL, override.Repository.URL)
+		p.Repository = repo
+	}
+
+	if override.Support != nil {
+		s, o := new(Support), override.Support
+		if p.Support != nil {
+			*s = *p.Support
+		}
+		l.mergeString("support.website", &s.Website, o.Website)
+		l.mergeString("support.email", &s.Email, o.Email)
+		l.mergeString("support.forum", &s.Forum, o.Forum)
+		l.mergeString("support.wiki", &s.Wiki, o.Wiki)
+		l.mergeString("support.issues", &s.Issues, o.Issues)
+		p.Support = s
+	}
+
+	if len(override.Authors) > 0 {
+		p.Authors = override.Authors
+		l.origins["authors"] = LayerLocal
+	}
+	if len(override.Contributors) > 0 {
+		p.Contributors = override.Contributors
+		l.origins["contributors"] = LayerLocal
+	}
+	if len(override.Subpackages) > 0 {
+		p.Subpackages = override.Subpackages
+		l.origins["subpackages"] = LayerLocal
+	}
+
+	p.Dependencies = l.mergeDependencies("dependencies",
+		base.Dependencies, override.Dependencies)
+
+	if len(override.Environments) > 0 {
+		envs := make(map[string][]*Dependency)
+		for env, deps := range base.Environments {
+			envs[env] = deps
+		}
+		for env, deps := range override.Environments {
+			envs[env] = l.mergeDependencies("environments."+env,
+				envs[env], deps)
+		}
+		p.Environments = envs
+	}
+
+	if override.Toolchain != nil {
+		tc, o := new(Toolchain), override.Toolchain
+		if p.Toolchain != nil {
+			*tc = *p.Toolchain
+		}
+		if len(o.Go) > 0 {
+			tc.Go = o.Go
+			l.origins["toolchain.go"] = LayerLocal
+		}
+		l.mergeStrings("toolchain.tags", &tc.Tags, o.Tags)
+		l.mergeStrings("toolchain.optionaltags", &tc.OptionalTags,
+			o.OptionalTags)
+		p.Toolchain = tc
+	}
+
+	if override.Hooks != nil {
+		h, o := new(Hooks), override.Hooks
+		if p.Hooks != nil {
+			*h = *p.Hooks
+		}
+		l.mergeStrings("hooks."+HookPreinstall, &h.Preinstall, o.Preinstall)
+		l.mergeStrings("hooks."+HookPostinstall, &h.Postinstall, o.Postinstall)
+		l.mergeStrings("hooks."+HookPretest, &h.Pretest, o.Pretest)
+		l.mergeStrings("hooks."+HookPrepublish, &h.Prepublish, o.Prepublish)
+		p.Hooks = h
+	}
+
+	if len(override.Extensions) > 0 {
+		extensions := make(map[string]interface{})
+		for key, value := range base.Extensions {
+			extensions[key] = value
+		}
+		for key, value := range override.Extensions {
+			extensions[key] = value
+			l.origins[key] = LayerLocal
+		}
+		p.Extensions = extensions
+	}
+
+	return l
+}
+
+// Origin returns the layer that the effective value at path came from, or an
+// empty string if the path has no value. Paths are lower case yaml keys
+// joined with dots, dependencies are addressed by name:
+//
+//	version
+//	repository.url
+//	dependencies.github.com/user/dep
+//	environments.test.github.com/user/dep
+//	x-ci
+func (l *LayeredPack) Origin(path string) string {
+	return l.origins[path]
+}
+
+// Origins returns a copy of the layer of every effective value by path.
+func (l *LayeredPack) Origins() map[string]string {
+	origins := make(map[string]string, len(l.origins))
+	for path, layer := range l.origins {
+		origins[path] = layer
+	}
+	return origins
+}
+
+// setOrigins records the layer for every value set in the pack.
+func (l *LayeredPack) setOrigins(p *Pack, layer string) {
+	for _, field := range packFields(p) {
+		if len(field.value) > 0 {
+			l.origins[field.name] = layer
+		}
+	}
+	if len(p.Authors) > 0 {
+		l.origins["authors"] = layer
+	}
+	if len(p.Contributors) > 0 {
+		l.origins["contributors"] = layer
+	}
+	for _, dep := range p.Dependencies {
+		l.origins["dependencies."+dep.Name] = layer
+	}
+	for env, deps := range p.Environments {
+		for _, dep := range deps {
+			l.origins["environments."+env+"."+dep.Name] = layer
+		}
+	}
+	if p.Hooks != nil {
+		for _, stage := range hookStages {
+			if commands, _ := p.Hooks.Commands(stage); len(commands) > 0 {
+				l.origins["hooks."+stage] = layer
+			}
+		}
+	}
+	for key := range p.Extensions {
+		l.origins[key] = layer
+	}
+}
+
+// mergeString replaces the value at dst if the override is not empty.
+func (l *LayeredPack) mergeString(path string, dst *string, override string) {
+	if len(override) > 0 {
+		*dst = override
+		l.origins[path] = LayerLocal
+	}
+}
+
+// mergeStrings replaces the list at dst if the override is not empty.
+func (l *LayeredPack) mergeStrings(path string, dst *[]string,
+	override []string) {
+
+	if len(override) > 0 {
+		*dst = override
+		l.origins[path] = LayerLocal
+	}
+}
+
+// mergeDependencies merges two lists of dependencies by name into a new list.
+func (l *LayeredPack) mergeDependencies(path string,
+	base, override []*Dependency) []*Dependency {
+
+	if len(override) == 0 {
+		return base
+	}
+
+	merged := make([]*Dependency, len(base))
+	copy(merged, base)
+	for _, dep := range override {
+		replaced := false
+		for i, existing := range merged {
+			if existing.Name == dep.Name {
+				merged[i] = dep
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, dep)
+		}
+		l.origins[path+"."+dep.Name] = LayerLocal
+	}
+	return merged
+}
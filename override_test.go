@@ -0,0 +1,176 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+var testOverrideBase = `name: package
+version: 1.0.0
+license: mit
+repository:
+  type: git
+  url: github.com/user/package
+dependencies:
+- dep >1.2.3
+- dep2 ~1.4.5
+environments:
+  test:
+  - dep4 <1.2.4
+hooks:
+  postinstall:
+  - go generate ./...
+  pretest:
+  - make test-deps
+x-ci: base
+x-owner: team
+`
+
+var testOverrideLocal = `version: 1.1.0-dev
+repository:
+  url: /home/user/package
+dependencies:
+- dep >1.2.3 git:/home/user/dep
+- dep3
+environments:
+  test:
+  - dep5
+  dev:
+  - dep6
+hooks:
+  pretest:
+  - make local-deps
+x-ci: local
+`
+
+func TestLocalPackFilename(t *T) {
+	t.Parallel()
+
+	var tests = []struct {
+		Input, Expect string
+	}{
+		{"pack.yaml", "pack.local.yaml"},
+		{"/a/b/pack.yml", "/a/b/pack.local.yml"},
+		{"pack", "pack.local"},
+	}
+	for _, test := range tests {
+		if out := LocalPackFilename(test.Input); out != test.Expect {
+			t.Errorf("Expected: %s, got: %s", test.Expect, out)
+		}
+	}
+}
+
+func TestMergePacks(t *T) {
+	t.Parallel()
+
+	base := mustParsePack(t, testOverrideBase)
+	local := mustParsePack(t, testOverrideLocal)
+	l := MergePacks(base, local)
+
+	if l.Name != "package" || l.Version.String() != "1.1.0-dev" {
+		t.Error("Unexpected scalars:", l.Name, l.Version)
+	}
+	if l.Repository.Type != "git" || l.Repository.URL != "/home/user/package" {
+		t.Error("Unexpected repository:", l.Repository)
+	}
+	if base.Repository.URL != "github.com/user/package" {
+		t.Error("The base pack should not be modified.")
+	}
+
+	if ln := len(l.Dependencies); ln != 3 {
+		t.Fatal("Expected 3 dependencies, got:", ln)
+	}
+	if d := l.Dependencies[0]; d.String() != "dep >1.2.3 git:/home/user/dep" {
+		t.Error("Expected the override dependency first, got:", d)
+	}
+	if d := l.Dependencies[2]; d.Name != "dep3" {
+		t.Error("Expected the new dependency last, got:", d)
+	}
+	if ln := len(l.Environments["test"]); ln != 2 {
+		t.Error("Expected test environments to be merged, got:", ln)
+	}
+	if ln := len(l.Environments["dev"]); ln != 1 {
+		t.Error("Expected dev environment to be added, got:", ln)
+	}
+	if l.Extensions["x-ci"] != "local" || l.Extensions["x-owner"] != "team" {
+		t.Error("Unexpected extensions:", l.Extensions)
+	}
+	if l.Hooks.Pretest[0] != "make local-deps" || len(l.Hooks.Postinstall) != 1 {
+		t.Error("Unexpected hooks:", l.Hooks)
+	}
+	if ln := len(base.Environments); ln != 1 {
+		t.Error("The base environments should not be modified, got:", ln)
+	}
+
+	var origins = []struct {
+		Path, Layer string
+	}{
+		{"name", LayerBase},
+		{"version", LayerLocal},
+		{"license", LayerBase},
+		{"repository.type", LayerBase},
+		{"repository.url", LayerLocal},
+		{"dependencies.dep", LayerLocal},
+		{"dependencies.dep2", LayerBase},
+		{"dependencies.dep3", LayerLocal},
+		{"environments.test.dep4", LayerBase},
+		{"environments.test.dep5", LayerLocal},
+		{"hooks.postinstall", LayerBase},
+		{"hooks.pretest", LayerLocal},
+		{"x-ci", LayerLocal},
+		{"x-owner", LayerBase},
+		{"summary", ""},
+	}
+	for _, o := range origins {
+		if layer := l.Origin(o.Path); layer != o.Layer {
+			t.Errorf("%s: expected layer: %q, got: %q", o.Path, o.Layer, layer)
+		}
+	}
+	if len(l.Origins()) == 0 {
+		t.Error("Expected origins.")
+	}
+}
+
+func TestParseLayeredPackFile(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopackoverride")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "pack.yaml")
+	err = ioutil.WriteFile(filename, []byte(testOverrideBase), 0660)
+	if err != nil {
+		t.Fatal("Could not write file:", err)
+	}
+
+	p, err := LoadPackFile(filename)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if p.Version.String() != "1.0.0" {
+		t.Error("Expected the base version without an override, got:", p.Version)
+	}
+
+	err = ioutil.WriteFile(LocalPackFilename(filename),
+		[]byte(testOverrideLocal), 0660)
+	if err != nil {
+		t.Fatal("Could not write file:", err)
+	}
+
+	l, err := ParseLayeredPackFile(filename)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if l.Local == nil || l.Version.String() != "1.1.0-dev" {
+		t.Error("Expected the override to be applied, got:", l.Version)
+	}
+
+	if _, err = LoadPackFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file.")
+	}
+}
@@ -5,12 +5,17 @@ to facilitate the reading, writing, and comparison of package metadata.
 package pack
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"io/ioutil"
 	"launchpad.net/goyaml"
 )
 
+const (
+	emptyMapping = `{}`
+)
+
 var (
 	errPartialWrite = errors.New(`pack: Partial write on pack serialization.`)
 )
@@ -22,6 +27,25 @@ type Author struct {
 	Homepage string   `yaml:",omitempty"`
 }
 
+// String turns an Author into the form: Name <email> (homepage)
+func (a *Author) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(a.Name)
+	for _, email := range a.Emails {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString("<" + email + ">")
+	}
+	if len(a.Homepage) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString("(" + a.Homepage + ")")
+	}
+	return buf.String()
+}
+
 // Support contains the locations at which to find support for the package.
 type Support struct {
 	Website string `yaml:",omitempty"`
@@ -33,7 +57,7 @@ type Support struct {
 
 // Repository is a version control repository endpoint.
 type Repository struct {
-	// Type can be one of: git/mercurial/bazaar
+	// Type can be one of: git/mercurial/bazaar/subversion
 	Type string `yaml:",omitempty"`
 	URL  string `yaml:",omitempty"`
 }
@@ -70,6 +94,13 @@ type Pack struct {
 	// same metadata. They must be subdirectories. This is useful for
 	// having subpackages within the same vcs repository.
 	Subpackages []string `yaml:",omitempty"`
+	// Toolchain is what the package requires of the go toolchain.
+	Toolchain *Toolchain `yaml:",omitempty"`
+	// Hooks are commands that are run at points in the package's lifecycle.
+	Hooks *Hooks `yaml:",omitempty"`
+	// Extensions are the keys that are not part of the pack format, they're
+	// preserved so that other tools can store their own metadata, ie. x-ci
+	Extensions map[string]interface{} `yaml:"-"`
 }
 
 // ParsePack reads yaml from a reader and parses it into a pack object.
@@ -87,16 +118,43 @@ func ParsePack(reader io.Reader) (*Pack, error) {
 		return nil, err
 	}
 
+	var fields map[string]interface{}
+	if err = goyaml.Unmarshal(read, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if isPackField(key) {
+			continue
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		p.Extensions[key] = value
+	}
+
 	return p, nil
 }
 
-// WriteTo writes the pack object to the passed in writer.
+// WriteTo writes the pack object to the passed in writer. Extensions are
+// written after the fields of the pack.
 func (p *Pack) WriteTo(writer io.Writer) error {
 	written, err := goyaml.Marshal(p)
 	if err != nil {
 		return err
 	}
 
+	if len(p.Extensions) > 0 {
+		extensions, err := goyaml.Marshal(p.Extensions)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(bytes.TrimSpace(written), []byte(emptyMapping)) {
+			written = extensions
+		} else {
+			written = append(written, extensions...)
+		}
+	}
+
 	n, err := writer.Write(written)
 	if err != nil {
 		return err
@@ -137,3 +137,25 @@ func TestPack_WriteTo(t *T) {
 		t.Error("Expecting partial write error, got:", err)
 	}
 }
+
+func TestAuthor_String(t *T) {
+	t.Parallel()
+
+	var tests = []struct {
+		Author Author
+		Expect string
+	}{
+		{Author{}, ""},
+		{Author{Name: "Jane Doe"}, "Jane Doe"},
+		{Author{"Jane Doe", []string{"jane@x.com"}, "https://jane.dev"},
+			"Jane Doe <jane@x.com> (https://jane.dev)"},
+		{Author{Emails: []string{"a@x.com", "b@x.com"}},
+			"<a@x.com> <b@x.com>"},
+	}
+
+	for _, test := range tests {
+		if s := test.Author.String(); s != test.Expect {
+			t.Errorf("Expected: %q, got: %q", test.Expect, s)
+		}
+	}
+}
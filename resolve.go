@@ -0,0 +1,771 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// rootName is used for the root pack when it has no name.
+	rootName = "root"
+)
+
+// VersionSource supplies what a resolver needs to know about packages. A
+// source that does slow work, such as running version control commands,
+// should stop it and return ctx.Err() when ctx is done.
+type VersionSource interface {
+	// Versions lists every available version of the named package.
+	Versions(ctx context.Context, name string) ([]*Version, error)
+	// Pack returns the metadata of the named package at a version. A
+	// package without any metadata should return an empty Pack.
+	Pack(ctx context.Context, name string, version *Version) (*Pack, error)
+}
+
+// Requirement is a dependency declared by one package on another.
+type Requirement struct {
+	// From is the name of the package that declared the dependency.
+	From string
+	// FromVersion is the version of From, nil for the root pack.
+	FromVersion *Version
+	// Environment is the environment the dependency was declared in, empty
+	// for the default Dependencies.
+	Environment string
+	// Dependency is the declaration itself.
+	Dependency *Dependency
+}
+
+// String describes the requirement, ie. a 1.2.0 depends on b >=2.0.0
+func (r *Requirement) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(r.From)
+	if r.FromVersion != nil {
+		buf.WriteByte(' ')
+		buf.WriteString(r.FromVersion.String())
+	}
+	buf.WriteString(" depends on ")
+	buf.WriteString(r.target())
+	if len(r.Environment) > 0 {
+		fmt.Fprintf(&buf, " (%s)", r.Environment)
+	}
+	return buf.String()
+}
+
+// target is the name and constraints of the required package.
+func (r *Requirement) target() string {
+	if len(r.Dependency.Constraints) == 0 {
+		return r.Dependency.Name
+	}
+	return r.Dependency.Name + " " + r.Dependency.Constraints.String()
+}
+
+// Resolution is a consistent set of versions for every transitive dependency
+// of a root pack.
+type Resolution struct {
+	// Root is the pack that was resolved.
+	Root *Pack
+	// Environment is the environment the root was resolved in.
+	Environment string
+	// Versions is the selected version of each dependency by name.
+	Versions map[string]*Version
+	// Packs is the metadata of each dependency at its selected version.
+	Packs map[string]*Pack
+	// Requirements are all the dependency declarations in the resolved
+	// graph in the order they were discovered.
+	Requirements []*Requirement
+}
+
+// Names returns the names of the selected dependencies in sorted order.
+func (r *Resolution) Names() []string {
+	names := make([]string, 0, len(r.Versions))
+	for name := range r.Versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConflictError is returned when no set of versions satisfies every
+// requirement.
+type ConflictError struct {
+	// Name is the package that could not be given a version.
+	Name string
+	// Requirements are the requirements on Name that could not be satisfied
+	// together.
+	Requirements []*Requirement
+	// Versions are the available versions of Name.
+	Versions []*Version
+	// Derivations are the chains of requirements that lead from the root to
+	// each of Requirements, in the same order. Each chain starts with a
+	// requirement of the root and ends with the requirement on Name.
+	Derivations [][]*Requirement
+	// Rejected are the other versions that were tried on the way to this
+	// conflict, in the order they were tried, and why each failed.
+	Rejected []*Rejection
+}
+
+// Rejection is a version of a package that was tried and could not be used.
+type Rejection struct {
+	Name    string
+	Version *Version
+	// Conflict is why the version could not be used.
+	Conflict *ConflictError
+}
+
+// Error implements the error interface.
+func (c *ConflictError) Error() string {
+	return "pack: " + c.reason()
+}
+
+// reason describes the conflict without naming the package that reports it.
+func (c *ConflictError) reason() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "no version of %s satisfies every requirement: ",
+		c.Name)
+	for i, req := range c.Requirements {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(req.String())
+	}
+	return buf.String()
+}
+
+// Explain describes how the conflict was derived as numbered lines. Each
+// dependency declaration in the derivations is listed once, followed by
+// what it means for Name, then why each rejected version failed, and
+// finally why Name can't be given a version:
+//
+//  1. app depends on a
+//  2. a 1.3.0 depends on b <2.0.0
+//  3. So app needs b <2.0.0 (1, 2)
+//  4. app depends on c
+//  5. c 1.0.0 depends on b >=2.0.0
+//  6. So app needs b >=2.0.0 (4, 5)
+//  7. a 1.4.0 was rejected, no version of e satisfies every requirement:
+//     a 1.4.0 depends on e >=5.0.0
+//  8. No version of b satisfies (3) and (6), available: 2.0.0, 1.0.0
+func (c *ConflictError) Explain() string {
+	var buf bytes.Buffer
+	var n int
+	var line = func(format string, args ...interface{}) string {
+		n++
+		fmt.Fprintf(&buf, "%d. ", n)
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteByte('\n')
+		return strconv.Itoa(n)
+	}
+
+	lines := make(map[*Requirement]string)
+	causes := make([]string, 0, len(c.Requirements))
+	for i, req := range c.Requirements {
+		chain := []*Requirement{req}
+		if i < len(c.Derivations) && len(c.Derivations[i]) > 0 {
+			chain = c.Derivations[i]
+		}
+
+		refs := make([]string, 0, len(chain))
+		for _, r := range chain {
+			ref, ok := lines[r]
+			if !ok {
+				ref = line("%s", r)
+				lines[r] = ref
+			}
+			refs = append(refs, ref)
+		}
+
+		cause := refs[len(refs)-1]
+		if len(chain) > 1 {
+			cause = line("So %s needs %s (%s)", chain[0].From, req.target(),
+				strings.Join(refs, ", "))
+		}
+		causes = append(causes, "("+cause+")")
+	}
+
+	for _, r := range c.Rejected {
+		line("%s %s was rejected, %s", r.Name, r.Version, r.Conflict.reason())
+	}
+
+	available := "none"
+	if len(c.Versions) > 0 {
+		versions := make([]string, len(c.Versions))
+		for i, v := range c.Versions {
+			versions[i] = v.String()
+		}
+		available = strings.Join(versions, ", ")
+	}
+	line("No version of %s satisfies %s, available: %s", c.Name,
+		joinAnd(causes), available)
+	return buf.String()
+}
+
+// joinAnd joins a list in English, ie. a, b and c
+func joinAnd(list []string) string {
+	if len(list) < 2 {
+		return strings.Join(list, "")
+	}
+	last := len(list) - 1
+	return strings.Join(list[:last], ", ") + " and " + list[last]
+}
+
+// Strategy is how a resolver chooses between the versions of a package.
+type Strategy int
+
+// Defines the resolution strategies.
+const (
+	// Newest selects the newest version that satisfies every requirement,
+	// backtracking when choices conflict.
+	Newest Strategy = iota
+	// Minimal selects the oldest version that satisfies the lower bounds of
+	// every requirement, the way Go modules do. It never searches, so the
+	// result only changes when requirements change.
+	Minimal
+)
+
+// String returns the name of the strategy.
+func (s Strategy) String() string {
+	switch s {
+	case Newest:
+		return "newest"
+	case Minimal:
+		return "minimal"
+	}
+	return fmt.Sprintf("strategy(%d)", int(s))
+}
+
+// Resolver selects versions for the transitive dependencies of a pack.
+type Resolver struct {
+	// Source supplies the versions and metadata of packages.
+	Source VersionSource
+	// Strategy is used by Resolve, Newest by default.
+	Strategy Strategy
+}
+
+// NewResolver creates a resolver that uses source.
+func NewResolver(source VersionSource) *Resolver {
+	return &Resolver{Source: source}
+}
+
+// Resolve is a shortcut for NewResolver(source).Resolve(root, env).
+func Resolve(root *Pack, env string, source VersionSource) (*Resolution,
+	error) {
+
+	return NewResolver(source).Resolve(root, env)
+}
+
+// Resolve selects a version for every transitive dependency of root in the
+// environment with the resolver's Strategy.
+func (r *Resolver) Resolve(root *Pack, env string) (*Resolution, error) {
+	return r.ResolveContext(context.Background(), root, env)
+}
+
+// ResolveContext is Resolve with a context that is passed to the Source.
+func (r *Resolver) ResolveContext(ctx context.Context, root *Pack,
+	env string) (*Resolution, error) {
+
+	return r.resolve(ctx, root, env, r.Strategy)
+}
+
+// ResolveStrategy selects a version for every transitive dependency of root
+// in the environment with the given strategy. Only the root's environment
+// dependencies are used, dependencies of dependencies are their default
+// Dependencies. If no solution exists a *ConflictError is returned.
+func (r *Resolver) ResolveStrategy(root *Pack, env string,
+	strategy Strategy) (*Resolution, error) {
+
+	return r.resolve(context.Background(), root, env, strategy)
+}
+
+// resolve implements ResolveStrategy with a context.
+func (r *Resolver) resolve(ctx context.Context, root *Pack, env string,
+	strategy Strategy) (*Resolution, error) {
+
+	s := &solver{
+		ctx:      ctx,
+		source:   r.Source,
+		root:     packName(root),
+		reqs:     rootRequirements(root, env),
+		selected: make(map[string]*Version),
+		packs:    make(map[string]*Pack),
+		versions: make(map[string][]*Version),
+		cache:    make(map[string]*Pack),
+	}
+
+	var err error
+	switch strategy {
+	case Newest:
+		err = s.solve()
+	case Minimal:
+		err = s.minimal()
+	default:
+		err = fmt.Errorf("pack: Unknown resolution strategy %d.", int(strategy))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolution{
+		Root:         root,
+		Environment:  env,
+		Versions:     s.selected,
+		Packs:        s.packs,
+		Requirements: s.reqs,
+	}, nil
+}
+
+// UpdateMode limits how far Update may move the dependencies it updates.
+type UpdateMode int
+
+// Defines the update modes.
+const (
+	// UpdateNewest moves to the newest version that satisfies every
+	// requirement.
+	UpdateNewest UpdateMode = iota
+	// UpdatePatch only moves to versions with the same major and minor
+	// version as the previous resolution.
+	UpdatePatch
+)
+
+// Update resolves root again in the environment of a previous resolution,
+// updating only the named dependencies. The named dependencies move to the
+// newest version the mode allows, every other dependency keeps its previous
+// version wherever that is still valid and only changes when it must. With
+// no names every dependency is updated. Updates always use the Newest
+// strategy.
+func (r *Resolver) Update(root *Pack, previous *Resolution, mode UpdateMode,
+	names ...string) (*Resolution, error) {
+
+	env := previous.Environment
+	s := &solver{
+		ctx:      context.Background(),
+		source:   r.Source,
+		root:     packName(root),
+		reqs:     rootRequirements(root, env),
+		selected: make(map[string]*Version),
+		packs:    make(map[string]*Pack),
+		versions: make(map[string][]*Version),
+		cache:    make(map[string]*Pack),
+		pinned:   previous.Versions,
+		patch:    mode == UpdatePatch,
+	}
+	if len(names) > 0 {
+		s.targets = make(map[string]bool)
+		for _, name := range names {
+			s.targets[name] = true
+		}
+	}
+
+	if err := s.solve(); err != nil {
+		return nil, err
+	}
+
+	return &Resolution{
+		Root:         root,
+		Environment:  env,
+		Versions:     s.selected,
+		Packs:        s.packs,
+		Requirements: s.reqs,
+	}, nil
+}
+
+// EnvironmentDependencies returns the pack's Dependencies followed by the
+// dependencies of each environment named by env. Environments nest with
+// dots so prod.test includes prod and then prod.test.
+func (p *Pack) EnvironmentDependencies(env string) []*Dependency {
+	var deps []*Dependency
+	for _, req := range rootRequirements(p, env) {
+		deps = append(deps, req.Dependency)
+	}
+	return deps
+}
+
+// environmentChain returns the environments that make up env, ie. for
+// prod.test it is prod, prod.test
+func environmentChain(env string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	var chain []string
+	for i := 0; i < len(env); i++ {
+		if env[i] == '.' {
+			chain = append(chain, env[:i])
+		}
+	}
+	return append(chain, env)
+}
+
+// rootRequirements creates the requirements of the root pack.
+func rootRequirements(p *Pack, env string) []*Requirement {
+	name := packName(p)
+	var reqs []*Requirement
+	for _, dep := range p.Dependencies {
+		reqs = append(reqs, &Requirement{From: name, Dependency: dep})
+	}
+	for _, e := range environmentChain(env) {
+		for _, dep := range p.Environments[e] {
+			reqs = append(reqs, &Requirement{
+				From: name, Environment: e, Dependency: dep,
+			})
+		}
+	}
+	return reqs
+}
+
+// packName is the name a pack is known by in a dependency graph.
+func packName(p *Pack) string {
+	switch {
+	case len(p.ImportPath) > 0:
+		return p.ImportPath
+	case len(p.Name) > 0:
+		return p.Name
+	}
+	return rootName
+}
+
+// solver holds the state of a single resolution.
+type solver struct {
+	ctx    context.Context
+	source VersionSource
+	root   string
+
+	// reqs are the active requirements, the root's first followed by those
+	// of each selected pack in the order they were selected.
+	reqs     []*Requirement
+	selected map[string]*Version
+	packs    map[string]*Pack
+
+	versions map[string][]*Version
+	cache    map[string]*Pack
+
+	// pinned are the versions of a previous resolution, targets are the
+	// names being updated, all of them when nil, and patch limits targets to
+	// the major and minor version they are pinned at.
+	pinned  map[string]*Version
+	targets map[string]bool
+	patch   bool
+}
+
+// solve selects a version for the next unselected requirement and recurses,
+// undoing the selection and trying the next version when it fails. When
+// every version fails the conflict of the last one is returned, with the
+// versions tried before it recorded as rejected.
+func (s *solver) solve() error {
+	name := s.next()
+	if len(name) == 0 {
+		return nil
+	}
+
+	versions, err := s.candidates(name)
+	if err != nil {
+		return err
+	}
+	reqs := s.requirementsOn(name)
+
+	var failed []*Rejection
+	for _, v := range versions {
+		if !satisfiesAll(reqs, v) {
+			continue
+		}
+
+		p, err := s.pack(name, v)
+		if err != nil {
+			return err
+		}
+		deps := packRequirements(name, v, p)
+		if conflict := s.check(deps); conflict != nil {
+			failed = append(failed, &Rejection{name, v, conflict})
+			continue
+		}
+
+		mark := len(s.reqs)
+		s.selected[name] = v
+		s.packs[name] = p
+		s.reqs = append(s.reqs, deps...)
+
+		err = s.solve()
+		conflict, ok := err.(*ConflictError)
+		if !ok {
+			return err
+		}
+		failed = append(failed, &Rejection{name, v, conflict})
+
+		delete(s.selected, name)
+		delete(s.packs, name)
+		s.reqs = s.reqs[:mark]
+	}
+
+	if len(failed) == 0 {
+		return s.newConflict(name, reqs, versions)
+	}
+	last := failed[len(failed)-1].Conflict
+	last.Rejected = append(last.Rejected, failed[:len(failed)-1]...)
+	return last
+}
+
+// minimal performs minimal version selection. Every requirement reached from
+// the root picks the oldest version that satisfies it, and the packs of those
+// versions add their own requirements. Each package is then selected at the
+// newest of the versions picked for it, which is the minimum that satisfies
+// every lower bound. Finally the requirements of the selected packs are
+// checked, since an upper bound may not be satisfied by the selection.
+func (s *solver) minimal() error {
+	picked := make(map[string]*Version)
+	reached := make(map[string]bool)
+	reqs := s.reqs
+	for i := 0; i < len(reqs); i++ {
+		req := reqs[i]
+		name := req.Dependency.Name
+		if name == s.root {
+			continue
+		}
+
+		versions, err := s.available(name)
+		if err != nil {
+			return err
+		}
+		var min *Version
+		for j := len(versions) - 1; j >= 0; j-- {
+			if req.Dependency.Constraints.Satisfied(versions[j]) {
+				min = versions[j]
+				break
+			}
+		}
+		if min == nil {
+			s.reqs = reqs
+			return s.newConflict(name, []*Requirement{req}, versions)
+		}
+
+		if v, ok := picked[name]; !ok || v.Compare(min) < 0 {
+			picked[name] = min
+		}
+		key := name + "@" + min.String()
+		if reached[key] {
+			continue
+		}
+		reached[key] = true
+
+		p, err := s.pack(name, min)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, packRequirements(name, min, p)...)
+	}
+
+	// Only the packages that the selected versions still require are kept.
+	for i := 0; i < len(s.reqs); i++ {
+		name := s.reqs[i].Dependency.Name
+		if _, ok := s.selected[name]; ok || name == s.root {
+			continue
+		}
+		v := picked[name]
+		p, err := s.pack(name, v)
+		if err != nil {
+			return err
+		}
+		s.selected[name] = v
+		s.packs[name] = p
+		s.reqs = append(s.reqs, packRequirements(name, v, p)...)
+	}
+
+	for _, req := range s.reqs {
+		name := req.Dependency.Name
+		if name == s.root || req.Dependency.Constraints.Satisfied(
+			s.selected[name]) {
+
+			continue
+		}
+		return s.newConflict(name, s.requirementsOn(name), s.versions[name])
+	}
+	return nil
+}
+
+// next returns the first package that is required but not yet selected.
+func (s *solver) next() string {
+	for _, req := range s.reqs {
+		name := req.Dependency.Name
+		if name == s.root {
+			continue
+		}
+		if _, ok := s.selected[name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// requirementsOn returns the active requirements on a package.
+func (s *solver) requirementsOn(name string) []*Requirement {
+	var reqs []*Requirement
+	for _, req := range s.reqs {
+		if req.Dependency.Name == name {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// check makes sure that new requirements are satisfied by the versions
+// that have already been selected.
+func (s *solver) check(reqs []*Requirement) *ConflictError {
+	for _, req := range reqs {
+		name := req.Dependency.Name
+		v, ok := s.selected[name]
+		if !ok || req.Dependency.Constraints.Satisfied(v) {
+			continue
+		}
+		return s.newConflict(name, append(s.requirementsOn(name), req),
+			s.versions[name])
+	}
+	return nil
+}
+
+// newConflict creates a conflict error with the derivation of each
+// requirement.
+func (s *solver) newConflict(name string, reqs []*Requirement,
+	versions []*Version) *ConflictError {
+
+	derivations := make([][]*Requirement, len(reqs))
+	for i, req := range reqs {
+		derivations[i] = s.derive(req)
+	}
+	return &ConflictError{
+		Name:         name,
+		Requirements: reqs,
+		Versions:     versions,
+		Derivations:  derivations,
+	}
+}
+
+// derive returns the chain of requirements from the root to req. Each
+// package in the chain is reached through the first requirement that was
+// made on it, which is the one that caused it to be selected.
+func (s *solver) derive(req *Requirement) []*Requirement {
+	chain := []*Requirement{req}
+	seen := map[string]bool{req.From: true}
+	for from := req.From; from != s.root; {
+		var by *Requirement
+		for _, r := range s.reqs {
+			if r.Dependency.Name == from {
+				by = r
+				break
+			}
+		}
+		if by == nil || seen[by.From] {
+			break
+		}
+		seen[by.From] = true
+		chain = append(chain, by)
+		from = by.From
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// available returns the versions of a package from newest to oldest.
+func (s *solver) available(name string) ([]*Version, error) {
+	if versions, ok := s.versions[name]; ok {
+		return versions, nil
+	}
+	versions, err := s.source.Versions(s.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]*Version, len(versions))
+	copy(sorted, versions)
+	SortVersions(sorted)
+	for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+	}
+	s.versions[name] = sorted
+	return sorted, nil
+}
+
+// candidates returns the versions of a package in the order they should be
+// tried. Without a previous resolution that is newest first. A package that
+// is pinned and not being updated tries its pinned version first, and one
+// that is being updated in patch mode only has the versions with its pinned
+// major and minor version.
+func (s *solver) candidates(name string) ([]*Version, error) {
+	versions, err := s.available(name)
+	if err != nil {
+		return nil, err
+	}
+	pin, ok := s.pinned[name]
+	if !ok {
+		return versions, nil
+	}
+
+	if s.targets == nil || s.targets[name] {
+		if !s.patch {
+			return versions, nil
+		}
+		var patches []*Version
+		for _, v := range versions {
+			if v.Major == pin.Major && v.Minor == pin.Minor {
+				patches = append(patches, v)
+			}
+		}
+		return patches, nil
+	}
+
+	ordered := make([]*Version, 0, len(versions))
+	for _, v := range versions {
+		if v.Compare(pin) == 0 {
+			ordered = append(ordered, v)
+		}
+	}
+	for _, v := range versions {
+		if v.Compare(pin) != 0 {
+			ordered = append(ordered, v)
+		}
+	}
+	return ordered, nil
+}
+
+// pack returns the metadata of a package at a version.
+func (s *solver) pack(name string, v *Version) (*Pack, error) {
+	key := name + "@" + v.String()
+	if p, ok := s.cache[key]; ok {
+		return p, nil
+	}
+	p, err := s.source.Pack(s.ctx, name, v)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = &Pack{}
+	}
+	s.cache[key] = p
+	return p, nil
+}
+
+// packRequirements creates the requirements of a dependency's pack, a
+// package's dependencies on itself are ignored.
+func packRequirements(name string, v *Version, p *Pack) []*Requirement {
+	var reqs []*Requirement
+	for _, dep := range p.Dependencies {
+		if dep.Name == name {
+			continue
+		}
+		reqs = append(reqs, &Requirement{
+			From: name, FromVersion: v, Dependency: dep,
+		})
+	}
+	return reqs
+}
+
+// satisfiesAll checks that a version satisfies every requirement.
+func satisfiesAll(reqs []*Requirement, v *Version) bool {
+	for _, req := range reqs {
+		if !req.Dependency.Constraints.Satisfied(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,430 @@
+package pack
+
+import (
+	"strings"
+	. "testing"
+)
+
+// testSource is a map of name -> version -> deps used to build a
+// MemorySource.
+type testSource map[string]map[string][]string
+
+func (s testSource) source(t *T) *MemorySource {
+	source := NewMemorySource()
+	for name, versions := range s {
+		for version, deps := range versions {
+			if err := source.AddVersion(name, version, deps...); err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+		}
+	}
+	return source
+}
+
+func testRoot(t *T, deps ...string) *Pack {
+	p := &Pack{ImportPath: "app"}
+	for _, str := range deps {
+		dep, err := ParseDependency(str)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		p.Dependencies = append(p.Dependencies, dep)
+	}
+	return p
+}
+
+func checkResolution(t *T, r *Resolution, exp map[string]string) {
+	if len(r.Versions) != len(exp) {
+		t.Errorf("Expected %d versions, got: %v", len(exp), r.Versions)
+	}
+	for name, version := range exp {
+		if v, ok := r.Versions[name]; !ok {
+			t.Errorf("Expected %s to be selected.", name)
+		} else if v.String() != version {
+			t.Errorf("Expected %s %s, got: %v", name, version, v)
+		}
+	}
+}
+
+func TestResolve(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {
+			"1.0.0": {"b >=1.0.0"},
+			"1.1.0": {"b >=1.1.0"},
+			"2.0.0": {"b >=2.0.0"},
+		},
+		"b": {
+			"1.0.0": nil,
+			"1.1.0": nil,
+			"1.2.0": {"c"},
+		},
+		"c": {
+			"0.1.0": {"app"},
+		},
+	}
+
+	r, err := Resolve(testRoot(t, "a <2.0.0"), "", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "1.1.0",
+		"b": "1.2.0",
+		"c": "0.1.0",
+	})
+	if r.Packs["b"] == nil || r.Packs["b"].Version.String() != "1.2.0" {
+		t.Error("Expected the pack of b at 1.2.0, got:", r.Packs["b"])
+	}
+	if names := r.Names(); strings.Join(names, " ") != "a b c" {
+		t.Error("Unexpected names:", names)
+	}
+	if ln := len(r.Requirements); ln != 4 {
+		t.Error("Expected 4 requirements, got:", ln)
+	}
+}
+
+func TestResolve_Backtrack(t *T) {
+	t.Parallel()
+
+	// The newest a needs a c that b can't live with, so a must go back.
+	source := testSource{
+		"a": {
+			"1.0.0": {"c ~1.0.0"},
+			"1.1.0": {"c ~1.0.0"},
+			"1.2.0": {"c >=2.0.0"},
+		},
+		"b": {
+			"1.0.0": {"c <2.0.0"},
+		},
+		"c": {
+			"1.0.0": nil,
+			"1.5.0": nil,
+			"2.0.0": nil,
+		},
+	}
+
+	r, err := Resolve(testRoot(t, "a", "b"), "", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "1.1.0",
+		"b": "1.0.0",
+		"c": "1.5.0",
+	})
+}
+
+func TestResolve_Environment(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.0.0": nil, "2.0.0": nil},
+		"t": {"1.0.0": nil},
+		"p": {"1.0.0": nil},
+	}
+	root := testRoot(t, "a")
+	root.Environments = map[string][]*Dependency{
+		"prod":      {{Name: "p"}},
+		"prod.test": {{Name: "t"}},
+		"dev":       {{Name: "missing"}},
+	}
+
+	r, err := Resolve(root, "prod.test", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "2.0.0",
+		"p": "1.0.0",
+		"t": "1.0.0",
+	})
+
+	deps := root.EnvironmentDependencies("prod")
+	if ln := len(deps); ln != 2 || deps[1].Name != "p" {
+		t.Error("Unexpected environment dependencies:", deps)
+	}
+
+	if _, err = Resolve(root, "dev", source.source(t)); err == nil {
+		t.Error("Expected the source error to be returned.")
+	} else if _, ok := err.(*ConflictError); ok {
+		t.Error("Expected a source error not a conflict, got:", err)
+	}
+}
+
+func TestResolve_Conflict(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.0.0": {"b <2.0.0"}},
+		"b": {"1.0.0": nil, "2.0.0": nil},
+		"c": {"1.0.0": {"b >=2.0.0"}},
+	}
+
+	_, err := Resolve(testRoot(t, "a", "c"), "", source.source(t))
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatal("Expected a conflict error, got:", err)
+	}
+	if conflict.Name != "b" {
+		t.Error("Expected the conflict to be on b, got:", conflict.Name)
+	}
+	msg := conflict.Error()
+	if !strings.Contains(msg, "a 1.0.0 depends on b <2.0.0") ||
+		!strings.Contains(msg, "c 1.0.0 depends on b >=2.0.0") {
+
+		t.Error("Unexpected message:", msg)
+	}
+
+	_, err = Resolve(testRoot(t, "b >3.0.0"), "", source.source(t))
+	if conflict, ok = err.(*ConflictError); !ok {
+		t.Fatal("Expected a conflict error, got:", err)
+	} else if len(conflict.Versions) != 2 {
+		t.Error("Expected the available versions, got:", conflict.Versions)
+	}
+}
+
+func TestEnvironmentChain(t *T) {
+	t.Parallel()
+
+	var tests = []struct {
+		Env    string
+		Expect string
+	}{
+		{"", ""},
+		{"test", "test"},
+		{"prod.test", "prod prod.test"},
+		{"a.b.c", "a a.b a.b.c"},
+	}
+	for _, test := range tests {
+		chain := strings.Join(environmentChain(test.Env), " ")
+		if chain != test.Expect {
+			t.Errorf("%s: expected: %q, got: %q", test.Env, test.Expect, chain)
+		}
+	}
+}
+
+func TestConflictError_Explain(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.2.0": {"b <2.0.0"}, "1.3.0": {"b <2.0.0"}},
+		"b": {"1.0.0": nil, "2.0.0": nil},
+		"c": {"1.0.0": {"d"}},
+		"d": {"1.0.0": {"b >=2.0.0"}},
+	}
+
+	_, err := Resolve(testRoot(t, "a >1.2.0", "c"), "", source.source(t))
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatal("Expected a conflict error, got:", err)
+	}
+	if len(conflict.Derivations) != 2 {
+		t.Fatal("Expected a derivation per requirement, got:",
+			conflict.Derivations)
+	}
+
+	exp := `1. app depends on a >1.2.0
+2. a 1.3.0 depends on b <2.0.0
+3. So app needs b <2.0.0 (1, 2)
+4. app depends on c
+5. c 1.0.0 depends on d
+6. d 1.0.0 depends on b >=2.0.0
+7. So app needs b >=2.0.0 (4, 5, 6)
+8. No version of b satisfies (3) and (7), available: 2.0.0, 1.0.0
+`
+	if got := conflict.Explain(); got != exp {
+		t.Errorf("Expected:\n%s\ngot:\n%s", exp, got)
+	}
+
+	_, err = Resolve(testRoot(t, "b >3.0.0"), "", source.source(t))
+	if conflict, ok = err.(*ConflictError); !ok {
+		t.Fatal("Expected a conflict error, got:", err)
+	}
+	exp = "1. app depends on b >3.0.0\n" +
+		"2. No version of b satisfies (1), available: 2.0.0, 1.0.0\n"
+	if got := conflict.Explain(); got != exp {
+		t.Errorf("Expected:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestConflictError_ExplainRejected(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.3.0": {"b <2.0.0"}, "1.4.0": {"e >=5.0.0"}},
+		"b": {"1.0.0": nil, "2.0.0": nil},
+		"c": {"1.0.0": {"b >=2.0.0"}},
+		"e": {"4.0.0": nil},
+	}
+
+	_, err := Resolve(testRoot(t, "a", "c"), "", source.source(t))
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatal("Expected a conflict error, got:", err)
+	}
+	if ln := len(conflict.Rejected); ln != 1 {
+		t.Fatal("Expected a rejected version, got:", conflict.Rejected)
+	} else if r := conflict.Rejected[0]; r.Name != "a" ||
+		r.Version.String() != "1.4.0" || r.Conflict.Name != "e" {
+
+		t.Error("Unexpected rejection:", r.Name, r.Version, r.Conflict)
+	}
+
+	exp := `1. app depends on a
+2. a 1.3.0 depends on b <2.0.0
+3. So app needs b <2.0.0 (1, 2)
+4. app depends on c
+5. c 1.0.0 depends on b >=2.0.0
+6. So app needs b >=2.0.0 (4, 5)
+7. a 1.4.0 was rejected, no version of e satisfies every requirement: ` +
+		`a 1.4.0 depends on e >=5.0.0
+8. No version of b satisfies (3) and (6), available: 2.0.0, 1.0.0
+`
+	if got := conflict.Explain(); got != exp {
+		t.Errorf("Expected:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestResolve_Minimal(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {
+			"1.0.0": {"b >=1.1.0"},
+			"1.1.0": {"b >=1.2.0", "d"},
+			"1.2.0": {"b >=1.3.0"},
+		},
+		"b": {"1.0.0": nil, "1.1.0": nil, "1.2.0": nil, "1.3.0": nil},
+		"c": {"1.0.0": {"a ~1.1.0"}, "2.0.0": nil},
+		"d": {"0.1.0": nil, "0.2.0": nil},
+	}
+	resolver := NewResolver(source.source(t))
+	resolver.Strategy = Minimal
+
+	r, err := resolver.Resolve(testRoot(t, "a >=1.0.0", "c <2.0.0"), "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "1.1.0",
+		"b": "1.2.0",
+		"c": "1.0.0",
+		"d": "0.1.0",
+	})
+	for _, req := range r.Requirements {
+		if req.From == "a" && req.FromVersion.String() != "1.1.0" {
+			t.Error("Expected only the selected a's requirements, got:", req)
+		}
+	}
+
+	// A package only required by a version that was not selected is dropped.
+	r, err = resolver.Resolve(testRoot(t, "a ~1.1.0", "a >=1.2.0"), "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{"a": "1.2.0", "b": "1.3.0"})
+
+	r, err = resolver.ResolveStrategy(testRoot(t, "a >=1.0.0"), "", Newest)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{"a": "1.2.0", "b": "1.3.0"})
+}
+
+func TestResolve_MinimalConflict(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.0.0": {"b <1.1.0"}},
+		"b": {"1.0.0": nil, "1.1.0": nil},
+	}
+	resolver := NewResolver(source.source(t))
+
+	_, err := resolver.ResolveStrategy(testRoot(t, "a", "b >=1.1.0"), "",
+		Minimal)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatal("Expected a conflict error, got:", err)
+	}
+	if conflict.Name != "b" || len(conflict.Requirements) != 2 {
+		t.Error("Unexpected conflict:", conflict)
+	}
+
+	_, err = resolver.ResolveStrategy(testRoot(t, "b >2.0.0"), "", Minimal)
+	if _, ok = err.(*ConflictError); !ok {
+		t.Error("Expected a conflict error, got:", err)
+	}
+	if _, err = resolver.ResolveStrategy(testRoot(t), "", 5); err == nil {
+		t.Error("Expected an error for an unknown strategy.")
+	}
+}
+
+func TestResolver_Update(t *T) {
+	t.Parallel()
+
+	old := testSource{
+		"a": {"1.0.0": {"c >=1.0.0"}},
+		"b": {"1.0.0": nil},
+		"c": {"1.0.0": nil},
+	}
+	root := testRoot(t, "a", "b", "c")
+	previous, err := Resolve(root, "", old.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	source := testSource{
+		"a": {"1.0.0": {"c >=1.0.0"}, "1.1.0": nil, "2.0.0": {"c >=2.0.0"}},
+		"b": {"1.0.0": nil, "1.0.1": nil, "1.1.0": nil},
+		"c": {"1.0.0": nil, "2.0.0": nil},
+	}
+	resolver := NewResolver(source.source(t))
+
+	r, err := resolver.Update(root, previous, UpdateNewest, "b")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "1.0.0",
+		"b": "1.1.0",
+		"c": "1.0.0",
+	})
+
+	r, err = resolver.Update(root, previous, UpdatePatch, "a", "b")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "1.0.0",
+		"b": "1.0.1",
+		"c": "1.0.0",
+	})
+
+	// Updating a forces c to move, since its pin is no longer valid.
+	r, err = resolver.Update(root, previous, UpdateNewest, "a")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "2.0.0",
+		"b": "1.0.0",
+		"c": "2.0.0",
+	})
+
+	r, err = resolver.Update(root, previous, UpdateNewest)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	checkResolution(t, r, map[string]string{
+		"a": "2.0.0",
+		"b": "1.1.0",
+		"c": "2.0.0",
+	})
+
+	_, err = resolver.Update(testRoot(t, "a >=2.0.0"), previous, UpdatePatch)
+	if _, ok := err.(*ConflictError); !ok {
+		t.Error("Expected a conflict error, got:", err)
+	}
+}
@@ -0,0 +1,342 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SIGSUFFIX is appended to a pack file's name for its signature file.
+	SIGSUFFIX = ".sig"
+	// PUBKEYEXT is the extension of public key files in a keyring directory.
+	PUBKEYEXT = ".pub"
+
+	keyTypePublic  = "ed25519"
+	keyTypePrivate = "ed25519-private"
+	// signatureContext is prepended to the canonical pack before signing so
+	// that the signatures can't be confused with signatures of other data.
+	signatureContext = "gopack-signature-v1\n"
+
+	errFmtKey = `pack: [%v] keys must be in the form: type base64 [name]`
+)
+
+var (
+	errUnknownSigner  = errors.New(`pack: Signature is from an unknown key.`)
+	errBadSignature   = errors.New(`pack: Signature does not match the pack.`)
+	errEmptySignature = errors.New(`pack: Signature is missing fields.`)
+)
+
+// PublicKey is a named ed25519 key trusted to sign packs.
+type PublicKey struct {
+	Name string
+	Key  ed25519.PublicKey
+}
+
+// PrivateKey is a named ed25519 key used to sign packs.
+type PrivateKey struct {
+	Name string
+	Key  ed25519.PrivateKey
+}
+
+// Signature is a detached signature of a pack.
+type Signature struct {
+	// KeyID identifies the key that made the signature.
+	KeyID string `yaml:"keyid"`
+	// Signature is the base64 encoded ed25519 signature.
+	Signature string `yaml:"signature"`
+}
+
+// Verification is the result of a successful signature verification.
+type Verification struct {
+	// Signer is the name of the key that signed the pack.
+	Signer string
+	// KeyID identifies the key that signed the pack.
+	KeyID string
+}
+
+// Keyring is a set of trusted public keys.
+type Keyring struct {
+	keys map[string]*PublicKey
+}
+
+// GenerateKey creates a new private key with the given name.
+func GenerateKey(name string) (*PrivateKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{name, priv}, nil
+}
+
+// ParsePublicKey parses a public key in the form: ed25519 base64 [name]
+func ParsePublicKey(str string) (*PublicKey, error) {
+	name, key, err := parseKey(str, keyTypePublic, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{name, ed25519.PublicKey(key)}, nil
+}
+
+// ParsePrivateKey parses a private key in the form: ed25519-private base64
+// [name] where the key is the 32 byte seed.
+func ParsePrivateKey(str string) (*PrivateKey, error) {
+	name, seed, err := parseKey(str, keyTypePrivate, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{name, ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// parseKey parses a single line key of the given type and size.
+func parseKey(str, keyType string, size int) (string, []byte, error) {
+	fields := strings.Fields(str)
+	if len(fields) < 2 || fields[0] != keyType {
+		return "", nil, fmt.Errorf(errFmtKey, str)
+	}
+	key, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(key) != size {
+		return "", nil, fmt.Errorf(errFmtKey, str)
+	}
+	return strings.Join(fields[2:], " "), key, nil
+}
+
+// String turns the public key into the form accepted by ParsePublicKey.
+func (k *PublicKey) String() string {
+	return formatKey(keyTypePublic, k.Key, k.Name)
+}
+
+// ID is a short fingerprint of the key.
+func (k *PublicKey) ID() string {
+	sum := sha256.Sum256(k.Key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// String turns the private key into the form accepted by ParsePrivateKey.
+func (k *PrivateKey) String() string {
+	return formatKey(keyTypePrivate, k.Key.Seed(), k.Name)
+}
+
+// Public returns the public half of the key.
+func (k *PrivateKey) Public() *PublicKey {
+	return &PublicKey{k.Name, k.Key.Public().(ed25519.PublicKey)}
+}
+
+// formatKey formats a single line key.
+func formatKey(keyType string, key []byte, name string) string {
+	str := keyType + " " + base64.StdEncoding.EncodeToString(key)
+	if len(name) > 0 {
+		str += " " + name
+	}
+	return str
+}
+
+// NewKeyring creates a keyring trusting the given keys.
+func NewKeyring(keys ...*PublicKey) *Keyring {
+	k := &Keyring{make(map[string]*PublicKey)}
+	for _, key := range keys {
+		k.Add(key)
+	}
+	return k
+}
+
+// Add trusts a key.
+func (k *Keyring) Add(key *PublicKey) {
+	k.keys[key.ID()] = key
+}
+
+// Key finds a trusted key by its id.
+func (k *Keyring) Key(id string) (*PublicKey, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// Len returns the number of trusted keys.
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// ReadKeys adds every key in the reader to the keyring. There is one key per
+// line, blank lines and # comments are ignored.
+func (k *Keyring) ReadKeys(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, err := ParsePublicKey(line)
+		if err != nil {
+			return err
+		}
+		k.Add(key)
+	}
+	return scanner.Err()
+}
+
+// LoadKeyring creates a keyring from key files.
+func LoadKeyring(filenames ...string) (*Keyring, error) {
+	k := NewKeyring()
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		err = k.ReadKeys(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// LoadKeyringDir creates a keyring from every .pub file in a directory.
+func LoadKeyringDir(dir string) (*Keyring, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"+PUBKEYEXT))
+	if err != nil {
+		return nil, err
+	}
+	return LoadKeyring(filenames...)
+}
+
+// Canonical serializes the pack in the canonical form that is signed. It is
+// the yaml produced by WriteTo which has a fixed key order, so formatting and
+// comments in a pack file do not affect signatures.
+func (p *Pack) Canonical() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SignPack creates a detached signature of the pack's canonical form.
+func SignPack(p *Pack, key *PrivateKey) (*Signature, error) {
+	message, err := signedMessage(p)
+	if err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(key.Key, message)
+	return &Signature{
+		KeyID:     key.Public().ID(),
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// VerifyPack checks that the signature of the pack was made by a key in the
+// keyring.
+func VerifyPack(p *Pack, sig *Signature, keyring *Keyring) (*Verification,
+	error) {
+
+	if len(sig.KeyID) == 0 || len(sig.Signature) == 0 {
+		return nil, errEmptySignature
+	}
+	key, ok := keyring.Key(sig.KeyID)
+	if !ok {
+		return nil, errUnknownSigner
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return nil, err
+	}
+	message, err := signedMessage(p)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(key.Key, message, raw) {
+		return nil, errBadSignature
+	}
+	return &Verification{Signer: key.Name, KeyID: sig.KeyID}, nil
+}
+
+// signedMessage is the message that is actually signed for a pack.
+func signedMessage(p *Pack) ([]byte, error) {
+	canonical, err := p.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(signatureContext), canonical...), nil
+}
+
+// ParseSignature reads a signature from a reader.
+func ParseSignature(reader io.Reader) (*Signature, error) {
+	read, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	sig := new(Signature)
+	if err = goyaml.Unmarshal(read, sig); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Write writes the signature to the writer.
+func (s *Signature) Write(writer io.Writer) error {
+	written, err := goyaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	n, err := writer.Write(written)
+	if err != nil {
+		return err
+	}
+	if n != len(written) {
+		return errPartialWrite
+	}
+	return nil
+}
+
+// SignPackFile signs the pack file and writes the signature next to it. The
+// signature is written atomically like the pack file itself.
+func SignPackFile(filename string, key *PrivateKey) (*Signature, error) {
+	p, err := ParsePackFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := SignPack(p, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writeFileAtomic(filename+SIGSUFFIX, sig.Write); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// VerifyPackFile verifies the pack file against the signature next to it.
+func VerifyPackFile(filename string, keyring *Keyring) (*Verification,
+	error) {
+
+	p, err := ParsePackFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename + SIGSUFFIX)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sig, err := ParseSignature(file)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyPack(p, sig, keyring)
+}
@@ -0,0 +1,159 @@
+package pack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+func TestSignPack(t *T) {
+	t.Parallel()
+
+	key, err := GenerateKey("Jane Doe")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	other, err := GenerateKey("Mallory")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	p := mustParsePack(t, testPack)
+	sig, err := SignPack(p, key)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	keyring := NewKeyring(key.Public())
+	v, err := VerifyPack(p, sig, keyring)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if v.Signer != "Jane Doe" || v.KeyID != key.Public().ID() {
+		t.Error("Unexpected verification:", v)
+	}
+
+	// Reformatting the pack does not change its canonical form.
+	var buf bytes.Buffer
+	if err = p.WriteTo(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = VerifyPack(mustParsePack(t, buf.String()), sig,
+		keyring); err != nil {
+
+		t.Error("Expected the reparsed pack to verify, got:", err)
+	}
+
+	p.Version.Patch++
+	if _, err = VerifyPack(p, sig, keyring); err != errBadSignature {
+		t.Error("Expected a bad signature error, got:", err)
+	}
+	p.Version.Patch--
+
+	forged, err := SignPack(p, other)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = VerifyPack(p, forged, keyring); err != errUnknownSigner {
+		t.Error("Expected an unknown signer error, got:", err)
+	}
+	if _, err = VerifyPack(p, &Signature{}, keyring); err != errEmptySignature {
+		t.Error("Expected an empty signature error, got:", err)
+	}
+}
+
+func TestParseKeys(t *T) {
+	t.Parallel()
+
+	key, err := GenerateKey("Jane Doe")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	priv, err := ParsePrivateKey(key.String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if priv.Name != key.Name || !bytes.Equal(priv.Key, key.Key) {
+		t.Error("Expected the private key to round trip.")
+	}
+
+	pub, err := ParsePublicKey(key.Public().String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if pub.Name != "Jane Doe" || pub.ID() != key.Public().ID() {
+		t.Error("Expected the public key to round trip, got:", pub)
+	}
+
+	var bad = []string{
+		"",
+		"ed25519",
+		"rsa AAAA",
+		"ed25519 !!!!",
+		"ed25519 AAAA name",
+		key.String(),
+	}
+	for _, str := range bad {
+		if _, err = ParsePublicKey(str); err == nil {
+			t.Errorf("%q: expected an error.", str)
+		}
+	}
+}
+
+func TestSignPackFile(t *T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gopacksign")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := GenerateKey("Jane Doe")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	keyfile := filepath.Join(dir, "keys", "jane"+PUBKEYEXT)
+	if err = os.MkdirAll(filepath.Dir(keyfile), 0770); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	err = ioutil.WriteFile(keyfile,
+		[]byte("# Jane's key\n"+key.Public().String()+"\n"), 0660)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	filename := filepath.Join(dir, "pack.yaml")
+	if err = ioutil.WriteFile(filename, []byte(testPack), 0660); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = SignPackFile(filename, key); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	keyring, err := LoadKeyringDir(filepath.Dir(keyfile))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if keyring.Len() != 1 {
+		t.Error("Expected one key, got:", keyring.Len())
+	}
+
+	v, err := VerifyPackFile(filename, keyring)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if v.Signer != "Jane Doe" {
+		t.Error("Expected Jane Doe, got:", v.Signer)
+	}
+
+	if _, err = VerifyPackFile(filename, NewKeyring()); err != errUnknownSigner {
+		t.Error("Expected an unknown signer error, got:", err)
+	}
+	if _, err = LoadKeyring(filepath.Join(dir, "missing.pub")); err == nil {
+		t.Error("Expected an error for a missing key file.")
+	}
+}
@@ -0,0 +1,337 @@
+package pack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	errFmtUnknownPackage = `pack: [%v] unknown package`
+	errFmtUnknownVersion = `pack: [%v@%v] unknown version`
+	errFmtNoFileReader   = `pack: [%v] repository cannot read files at versions`
+)
+
+// Opener opens the repository of a package. Root is the import path of the
+// repository, which differs from name when the package is a subpackage.
+type Opener func(name string) (dvcs DVCS, root string, err error)
+
+// DVCSSource is a VersionSource that uses the tags of a package's repository
+// as its versions, and the pack file as it exists at each tag as its
+// metadata. The working copy is never changed. It is safe for concurrent
+// use, different repositories are opened concurrently and the packages of
+// one repository share it. Commands are run with the context of the lookup
+// when the repository implements ContextDVCS.
+type DVCSSource struct {
+	// Open returns the repository for a package name. The repository must
+	// also implement FileReader.
+	Open Opener
+	// Filename is the pack file's path in the repository, PACKFILE if empty.
+	Filename string
+
+	mut   sync.Mutex
+	roots map[string]string
+	repos map[string]*dvcsSourceRepo
+}
+
+// dvcsSourceRepo is an opened repository and its tags by version. done is
+// closed once it has been opened, err is set if that failed.
+type dvcsSourceRepo struct {
+	done chan struct{}
+	dvcs DVCS
+	tags map[string]string
+	err  error
+}
+
+// NewDVCSSource creates a DVCSSource that opens repositories with open.
+func NewDVCSSource(open Opener) *DVCSSource {
+	return &DVCSSource{Open: open}
+}
+
+// PathsOpener returns an Opener that finds packages in the paths. The
+// repository is the package's directory or the closest parent directory that
+// is a repository, this allows a dependency to be a subpackage of a
+// repository.
+func PathsOpener(paths *Paths) Opener {
+	return func(name string) (DVCS, string, error) {
+		dvcs, _, root, err := findRepository(paths, name)
+		return dvcs, root, err
+	}
+}
+
+// findRepository finds the repository of a package in the paths as
+// described by PathsOpener. It returns the repository, its directory and
+// its import path.
+func findRepository(paths *Paths, name string) (DVCS, string, string,
+	error) {
+
+	dir, _, err := paths.PackageExists(name)
+	if err != nil {
+		return nil, "", "", err
+	} else if len(dir) == 0 {
+		return nil, "", "", fmt.Errorf(errFmtUnknownPackage, name)
+	}
+
+	root := name
+	for i := strings.Count(name, "/"); i > 0; i-- {
+		if dvcs, err := DetectDVCS(dir); err == nil {
+			return dvcs, dir, root, nil
+		}
+		dir = filepath.Dir(dir)
+		root = path.Dir(root)
+	}
+	dvcs, err := DetectDVCS(dir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return dvcs, dir, root, nil
+}
+
+// Versions returns the versions of the package's tags.
+func (d *DVCSSource) Versions(ctx context.Context, name string) ([]*Version,
+	error) {
+
+	repo, err := d.repo(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*Version, 0, len(repo.tags))
+	for version := range repo.tags {
+		v, err := ParseVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	SortVersions(versions)
+	return versions, nil
+}
+
+// Pack reads the pack file as it exists at the version's tag. A package
+// without a pack file at that tag has an empty Pack.
+func (d *DVCSSource) Pack(ctx context.Context, name string,
+	version *Version) (*Pack, error) {
+
+	repo, err := d.repo(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := repo.tags[version.String()]
+	if !ok {
+		return nil, fmt.Errorf(errFmtUnknownVersion, name, version)
+	}
+	reader, ok := repo.dvcs.(FileReader)
+	if !ok {
+		return nil, fmt.Errorf(errFmtNoFileReader, name)
+	}
+
+	filename := d.Filename
+	if len(filename) == 0 {
+		filename = PACKFILE
+	}
+	contents, err := reader.ReadFile(ctx, tag, filename)
+	if os.IsNotExist(err) {
+		return &Pack{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParsePack(bytes.NewReader(contents))
+}
+
+// repo opens a package's repository and reads its tags once, the packages of
+// a repository share it by its root. Callers that want a repository that is
+// being opened wait for it, the lock is only held to find or add the
+// repository. A repository that fails to open is tried again by the next
+// caller.
+func (d *DVCSSource) repo(ctx context.Context, name string) (
+	*dvcsSourceRepo, error) {
+
+	dvcs, root, err := d.root(name)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mut.Lock()
+	if repo, ok := d.repos[root]; ok {
+		d.mut.Unlock()
+		select {
+		case <-repo.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// The caller that opened it gave up, but this one hasn't.
+		if isContextErr(repo.err) && ctx.Err() == nil {
+			return d.repo(ctx, name)
+		}
+		return repo, repo.err
+	}
+	if d.repos == nil {
+		d.repos = make(map[string]*dvcsSourceRepo)
+	}
+	repo := &dvcsSourceRepo{done: make(chan struct{})}
+	d.repos[root] = repo
+	d.mut.Unlock()
+
+	if dvcs == nil {
+		dvcs, _, repo.err = d.Open(name)
+	}
+	if repo.err == nil {
+		repo.err = repo.open(ctx, dvcs)
+	}
+	if repo.err != nil {
+		d.mut.Lock()
+		delete(d.repos, root)
+		d.mut.Unlock()
+	}
+	close(repo.done)
+	return repo, repo.err
+}
+
+// root returns the root of a package's repository. The first time it's
+// asked for a package the repository is opened to find it, and returned.
+func (d *DVCSSource) root(name string) (DVCS, string, error) {
+	d.mut.Lock()
+	root, ok := d.roots[name]
+	d.mut.Unlock()
+	if ok {
+		return nil, root, nil
+	}
+
+	dvcs, root, err := d.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	d.mut.Lock()
+	if d.roots == nil {
+		d.roots = make(map[string]string)
+	}
+	d.roots[name] = root
+	d.mut.Unlock()
+	return dvcs, root, nil
+}
+
+// open reads the tags of the repository.
+func (r *dvcsSourceRepo) open(ctx context.Context, dvcs DVCS) error {
+	tags, err := withContext(dvcs).TagsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.dvcs = dvcs
+	r.tags = make(map[string]string)
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil {
+			continue
+		}
+		r.tags[v.String()] = tag
+	}
+	return nil
+}
+
+// isContextErr checks if err is from a context being done.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// MemorySource is a VersionSource that holds packs in memory, it's useful
+// for tests and for resolving against metadata that was fetched elsewhere.
+type MemorySource struct {
+	mut   sync.RWMutex
+	packs map[string]map[string]*Pack
+}
+
+// NewMemorySource creates an empty MemorySource.
+func NewMemorySource() *MemorySource {
+	return &MemorySource{packs: make(map[string]map[string]*Pack)}
+}
+
+// Add adds a package at a version.
+func (m *MemorySource) Add(name string, version *Version, p *Pack) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	versions, ok := m.packs[name]
+	if !ok {
+		versions = make(map[string]*Pack)
+		m.packs[name] = versions
+	}
+	versions[version.String()] = p
+}
+
+// addName adds a package without adding any versions of it.
+func (m *MemorySource) addName(name string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if _, ok := m.packs[name]; !ok {
+		m.packs[name] = make(map[string]*Pack)
+	}
+}
+
+// AddVersion adds a package at a version that depends on deps, each of
+// which is parsed with ParseDependency.
+func (m *MemorySource) AddVersion(name, version string, deps ...string) error {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return err
+	}
+	p := &Pack{ImportPath: name, Version: v}
+	for _, str := range deps {
+		dep, err := ParseDependency(str)
+		if err != nil {
+			return err
+		}
+		p.Dependencies = append(p.Dependencies, dep)
+	}
+	m.Add(name, v, p)
+	return nil
+}
+
+// Versions returns the versions that were added for the package.
+func (m *MemorySource) Versions(ctx context.Context, name string) (
+	[]*Version, error) {
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	packs, ok := m.packs[name]
+	if !ok {
+		return nil, fmt.Errorf(errFmtUnknownPackage, name)
+	}
+	versions := make([]*Version, 0, len(packs))
+	for version := range packs {
+		v, err := ParseVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	SortVersions(versions)
+	return versions, nil
+}
+
+// Pack returns the pack that was added for the package at the version.
+func (m *MemorySource) Pack(ctx context.Context, name string,
+	version *Version) (*Pack, error) {
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	p, ok := m.packs[name][version.String()]
+	if !ok {
+		return nil, fmt.Errorf(errFmtUnknownVersion, name, version)
+	}
+	if p == nil {
+		p = &Pack{}
+	}
+	return p, nil
+}
@@ -0,0 +1,278 @@
+package pack
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	. "testing"
+	"time"
+)
+
+func TestMemorySource(t *T) {
+	t.Parallel()
+
+	source := NewMemorySource()
+	for _, version := range []string{"1.1.0", "0.1.0", "1.0.0"} {
+		if err := source.AddVersion("a", version, "b >=1.0.0"); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	if err := source.AddVersion("a", "bad"); err == nil {
+		t.Error("Expected an error for a bad version.")
+	}
+	if err := source.AddVersion("a", "2.0.0", "b !!"); err == nil {
+		t.Error("Expected an error for a bad dependency.")
+	}
+
+	versions, err := source.Versions(context.Background(), "a")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(versions) != 3 || versions[0].String() != "0.1.0" ||
+		versions[2].String() != "1.1.0" {
+
+		t.Error("Expected sorted versions, got:", versions)
+	}
+
+	p, err := source.Pack(context.Background(), "a", versions[1])
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if p.ImportPath != "a" || len(p.Dependencies) != 1 ||
+		p.Dependencies[0].Name != "b" {
+
+		t.Error("Unexpected pack:", p)
+	}
+
+	if _, err = source.Versions(context.Background(), "missing"); err == nil {
+		t.Error("Expected an error for an unknown package.")
+	}
+	v, _ := ParseVersion("9.9.9")
+	if _, err = source.Pack(context.Background(), "a", v); err == nil {
+		t.Error("Expected an error for an unknown version.")
+	}
+}
+
+// gitTestRepo creates a git repository with a pack file that has a
+// dependency on b >=1.0.0 at the tag 1.0.0, on b >=2.0.0 at the tag 1.1.0,
+// and no pack file at the tag 0.1.0.
+func gitTestRepo(t *T, dir string) {
+	var git = func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=gopack", "GIT_AUTHOR_EMAIL=gopack@example.com",
+			"GIT_COMMITTER_NAME=gopack", "GIT_COMMITTER_EMAIL=gopack@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	var write = func(filename, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, filename),
+			[]byte(contents), 0660)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+
+	git("init", "-q")
+	write("main.go", "package main\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "0.1.0")
+
+	write(PACKFILE, "importpath: a\ndependencies:\n  - b >=1.0.0\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "add pack file")
+	git("tag", "1.0.0")
+
+	write(PACKFILE, "importpath: a\ndependencies:\n  - b >=2.0.0\n")
+	git("commit", "-q", "-a", "-m", "update b")
+	git("tag", "1.1.0")
+}
+
+func TestDVCSSource(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopacksource")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "src", "host", "a")
+	if err = os.MkdirAll(filepath.Join(repo, "sub"), 0770); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	gitTestRepo(t, repo)
+
+	dvcs, err := DetectDVCS(repo)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, ok := dvcs.(*Git); !ok {
+		t.Errorf("Expected a git repository, got: %T", dvcs)
+	}
+	if _, err = DetectDVCS(dir); err == nil {
+		t.Error("Expected an error when there is no repository.")
+	}
+
+	reader := dvcs.(FileReader)
+	_, err = reader.ReadFile(context.Background(), "0.1.0", PACKFILE)
+	if !os.IsNotExist(err) {
+		t.Error("Expected a not exist error, got:", err)
+	}
+
+	paths, err := NewPaths(dir, "")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	source := NewDVCSSource(PathsOpener(paths))
+
+	versions, err := source.Versions(context.Background(), "host/a/sub")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(versions) != 3 || versions[2].String() != "1.1.0" {
+		t.Fatal("Unexpected versions:", versions)
+	}
+
+	var tests = []struct {
+		Version    *Version
+		Constraint string
+	}{
+		{versions[0], ""},
+		{versions[1], ">=1.0.0"},
+		{versions[2], ">=2.0.0"},
+	}
+	for _, test := range tests {
+		p, err := source.Pack(context.Background(), "host/a/sub", test.Version)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Version, err)
+			continue
+		}
+		if len(test.Constraint) == 0 {
+			if len(p.Dependencies) != 0 {
+				t.Errorf("%v: expected an empty pack, got: %v", test.Version, p)
+			}
+			continue
+		}
+		if len(p.Dependencies) != 1 ||
+			p.Dependencies[0].Constraints.String() != test.Constraint {
+
+			t.Errorf("%v: unexpected dependencies: %v",
+				test.Version, p.Dependencies)
+		}
+	}
+
+	_, err = source.Versions(context.Background(), "host/missing")
+	if err == nil {
+		t.Error("Expected an error for a missing package.")
+	}
+}
+
+// barrierDVCS is a testDVCS whose Tags only returns once every repository
+// sharing the barrier is listing its tags at the same time. listed counts the
+// calls to Tags.
+type barrierDVCS struct {
+	testDVCS
+	barrier *sync.WaitGroup
+	release chan struct{}
+	listed  *int32
+}
+
+func (b *barrierDVCS) Tags() ([]string, error) {
+	atomic.AddInt32(b.listed, 1)
+	b.barrier.Done()
+	select {
+	case <-b.release:
+		return b.tags, nil
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("tags were not listed concurrently")
+	}
+}
+
+func TestDVCSSource_Concurrent(t *T) {
+	t.Parallel()
+
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	release := make(chan struct{})
+	go func() {
+		barrier.Wait()
+		close(release)
+	}()
+
+	var listed int32
+	source := NewDVCSSource(func(name string) (DVCS, string, error) {
+		return &barrierDVCS{
+			testDVCS: testDVCS{tags: []string{"1.0.0"}},
+			barrier:  &barrier,
+			release:  release,
+			listed:   &listed,
+		}, strings.SplitN(name, "/", 2)[0], nil
+	})
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "a/sub", "b/sub", "a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			_, err := source.Versions(context.Background(), name)
+			if err != nil {
+				t.Error("Unexpected error:", err)
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	if listed != 2 {
+		t.Error("Expected the tags of each repository to be listed once, got:",
+			listed)
+	}
+}
+
+func TestDVCSSource_Cancel(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gopacksource")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	gitTestRepo(t, dir)
+
+	source := NewDVCSSource(func(name string) (DVCS, string, error) {
+		return NewGit(dir), name, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = source.Versions(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Error("Expected the lookup to be canceled, got:", err)
+	}
+
+	versions, err := source.Versions(context.Background(), "a")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(versions) != 3 {
+		t.Error("Expected a canceled lookup not to be kept, got:", versions)
+	}
+}
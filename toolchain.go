@@ -0,0 +1,154 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	errFmtGoVersion = `pack: [%v] go versions must be in the form: ` +
+		`go1.2 or 1.2.3`
+)
+
+var (
+	rgxGoVersion = regexp.MustCompile(
+		`^(?:go)?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(?:\.(0|[1-9][0-9]*))?` +
+			`((?:alpha|beta|rc)[1-9][0-9]*)?$`)
+)
+
+// Toolchain is what a package requires of the go toolchain that builds it.
+type Toolchain struct {
+	// Go constrains the go version, ie. >=1.2.0 <2.0.0
+	Go Constraints `yaml:",omitempty"`
+	// Tags are build tags that the package must be built with.
+	Tags []string `yaml:",omitempty"`
+	// OptionalTags are build tags that the package supports.
+	OptionalTags []string `yaml:",omitempty"`
+}
+
+// ToolchainError describes why a toolchain cannot build a package.
+type ToolchainError struct {
+	// Package is the import path of the package.
+	Package string
+	// GoVersion is the go version that was checked.
+	GoVersion *Version
+	// Constraints are the go version constraints, set only if they were not
+	// satisfied.
+	Constraints Constraints
+	// MissingTags are the required build tags that were not given.
+	MissingTags []string
+}
+
+// Error implements the error interface.
+func (t *ToolchainError) Error() string {
+	var reasons []string
+	if len(t.Constraints) > 0 {
+		reasons = append(reasons, fmt.Sprintf("go %v does not satisfy %v",
+			t.GoVersion, t.Constraints))
+	}
+	if len(t.MissingTags) > 0 {
+		reasons = append(reasons, fmt.Sprintf("missing build tags: %s",
+			strings.Join(t.MissingTags, " ")))
+	}
+	name := t.Package
+	if len(name) == 0 {
+		name = "package"
+	}
+	return fmt.Sprintf("pack: %s is incompatible with the toolchain, %s",
+		name, strings.Join(reasons, ", "))
+}
+
+// ParseGoVersion parses a go version as reported by go version (go1.2,
+// go1.2.1, go1.3rc1) into a Version. The patch version defaults to 0 and the
+// go prefix is optional.
+func ParseGoVersion(str string) (*Version, error) {
+	parts := rgxGoVersion.FindStringSubmatch(str)
+	if parts == nil {
+		return nil, fmt.Errorf(errFmtGoVersion, str)
+	}
+
+	var nums [3]uint
+	for i := range nums {
+		if len(parts[i+1]) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(parts[i+1], intBase, intSize)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = uint(n)
+	}
+
+	return &Version{nums[0], nums[1], nums[2], parts[4]}, nil
+}
+
+// LocalGoVersion runs go version to find the version of the local toolchain.
+func LocalGoVersion() (*Version, error) {
+	out, err := exec.Command("go", "version").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := bytes.Fields(out)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf(errFmtGoVersion, string(bytes.TrimSpace(out)))
+	}
+	return ParseGoVersion(string(fields[2]))
+}
+
+// Check returns a *ToolchainError if the go version does not satisfy the
+// constraints or any required tags are missing from tags.
+func (t *Toolchain) Check(goVersion *Version, tags []string) error {
+	err := &ToolchainError{GoVersion: goVersion}
+	if !t.Go.Satisfied(goVersion) {
+		err.Constraints = t.Go
+	}
+
+	for _, required := range t.Tags {
+		found := false
+		for _, tag := range tags {
+			if tag == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err.MissingTags = append(err.MissingTags, required)
+		}
+	}
+
+	if len(err.Constraints) == 0 && len(err.MissingTags) == 0 {
+		return nil
+	}
+	return err
+}
+
+// CheckToolchain checks that the pack can be built by the given go version
+// with the given build tags. If goVersion is empty the local toolchain's
+// version is used.
+func (p *Pack) CheckToolchain(goVersion string, tags []string) error {
+	if p.Toolchain == nil {
+		return nil
+	}
+
+	var v *Version
+	var err error
+	if len(goVersion) == 0 {
+		v, err = LocalGoVersion()
+	} else {
+		v, err = ParseGoVersion(goVersion)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = p.Toolchain.Check(v, tags); err != nil {
+		err.(*ToolchainError).Package = p.ImportPath
+		return err
+	}
+	return nil
+}
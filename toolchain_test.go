@@ -0,0 +1,99 @@
+package pack
+
+import (
+	"strings"
+	. "testing"
+)
+
+func TestParseGoVersion(t *T) {
+	t.Parallel()
+
+	var tests = []struct {
+		Input  string
+		Output Version
+		Error  bool
+	}{
+		{"go1.2", Version{1, 2, 0, ""}, false},
+		{"go1.21.3", Version{1, 21, 3, ""}, false},
+		{"1.3", Version{1, 3, 0, ""}, false},
+		{"go1.3rc1", Version{1, 3, 0, "rc1"}, false},
+		{"go1.22beta2", Version{1, 22, 0, "beta2"}, false},
+		{"devel", Version{}, true},
+		{"go1", Version{}, true},
+		{"go1.02", Version{}, true},
+	}
+
+	for _, test := range tests {
+		v, err := ParseGoVersion(test.Input)
+		if test.Error {
+			if err == nil {
+				t.Errorf("%s: expected an error.", test.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Input, err)
+		} else if *v != test.Output {
+			t.Errorf("%s: expected: %v, got: %v", test.Input, test.Output, v)
+		}
+	}
+}
+
+func TestPack_CheckToolchain(t *T) {
+	t.Parallel()
+
+	p := mustParsePack(t, `importpath: github.com/user/package
+toolchain:
+  go: '>=1.2.0 <2.0.0'
+  tags:
+  - netgo
+  optionaltags:
+  - sqlite
+`)
+	if p.Toolchain == nil || len(p.Toolchain.Go) != 2 {
+		t.Fatal("Expected a toolchain, got:", p.Toolchain)
+	}
+
+	if err := p.CheckToolchain("go1.3", []string{"netgo"}); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	err := p.CheckToolchain("go1.1", nil)
+	tcErr, ok := err.(*ToolchainError)
+	if !ok {
+		t.Fatal("Expected a toolchain error, got:", err)
+	}
+	if tcErr.Package != "github.com/user/package" ||
+		len(tcErr.Constraints) != 2 || len(tcErr.MissingTags) != 1 {
+
+		t.Error("Unexpected toolchain error:", tcErr)
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "1.1.0 does not satisfy >=1.2.0 <2.0.0") ||
+		!strings.Contains(msg, "missing build tags: netgo") {
+
+		t.Error("Unexpected error message:", msg)
+	}
+
+	if err = p.CheckToolchain("nope", nil); err == nil {
+		t.Error("Expected an error for a bad version.")
+	}
+	if err = (&Pack{}).CheckToolchain("nope", nil); err != nil {
+		t.Error("Expected no error without a toolchain, got:", err)
+	}
+}
+
+func TestLocalGoVersion(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	v, err := LocalGoVersion()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if v.Major < 1 {
+		t.Error("Unexpected go version:", v)
+	}
+}
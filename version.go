@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -196,6 +197,25 @@ func (b *Version) Satisfies(op ComparisonOp, c *Version) (ok bool) {
 	return
 }
 
+// Compare returns -1, 0 or 1 if the version is less than, equal to or greater
+// than the other version.
+func (v *Version) Compare(o *Version) int {
+	switch {
+	case v.Satisfies(LessThan, o):
+		return -1
+	case v.Satisfies(GreaterThan, o):
+		return 1
+	}
+	return 0
+}
+
+// SortVersions sorts versions in ascending order.
+func SortVersions(versions []*Version) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	})
+}
+
 // compareReleases returns an integer depicting the relationship between
 // release strings. Comparison is according to http://semver.org/
 func compareReleases(base, compare string) int {
@@ -370,3 +370,46 @@ func TestCompareOp_String(t *T) {
 		}
 	}
 }
+
+func TestVersion_Compare(t *T) {
+	t.Parallel()
+	var tests = []struct {
+		Base    string
+		Compare string
+		Result  int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "1.0.1", -1},
+		{"1.1.0", "1.0.9", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.0.0-a", "1.0.0", -1},
+		{"1.0.0", "1.0.0-a", 1},
+	}
+
+	for _, test := range tests {
+		b, _ := ParseVersion(test.Base)
+		c, _ := ParseVersion(test.Compare)
+		if r := b.Compare(c); r != test.Result {
+			t.Errorf("%v compare %v: expected %d, got %d",
+				b, c, test.Result, r)
+		}
+	}
+}
+
+func TestSortVersions(t *T) {
+	t.Parallel()
+
+	var versions []*Version
+	for _, s := range []string{"1.2.0", "0.1.0", "1.10.0", "1.2.0-pre"} {
+		v, _ := ParseVersion(s)
+		versions = append(versions, v)
+	}
+	SortVersions(versions)
+
+	exp := []string{"0.1.0", "1.2.0-pre", "1.2.0", "1.10.0"}
+	for i, v := range versions {
+		if v.String() != exp[i] {
+			t.Errorf("%d) Expected: %s, got: %v", i, exp[i], v)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package pack
+
+import (
+	"bytes"
+)
+
+// Chain is a path through a dependency graph from the root to a package.
+type Chain []*Requirement
+
+// Environment is the environment that introduced the chain, which is the
+// environment of its first requirement. It is empty for the default
+// Dependencies.
+func (c Chain) Environment() string {
+	if len(c) == 0 {
+		return ""
+	}
+	return c[0].Environment
+}
+
+// String describes the chain with the constraints of each requirement, ie.
+// app -> a ~1.0.0 (test) -> b >=1.2.0
+func (c Chain) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(c[0].From)
+	for _, req := range c {
+		buf.WriteString(" -> ")
+		buf.WriteString(req.target())
+		if len(req.Environment) > 0 {
+			buf.WriteString(" (")
+			buf.WriteString(req.Environment)
+			buf.WriteByte(')')
+		}
+	}
+	return buf.String()
+}
+
+// Why returns every chain of requirements from the root to a package, which
+// may be a subpackage. Chains never visit a package twice and end at the
+// first requirement on the package. They are in the order of a depth first
+// search of Edges, so chains that share a beginning are next to each other.
+// There are none when the package isn't in the graph.
+func (g *Graph) Why(name string) []Chain {
+	target := g.Node(name)
+	if target == g.Root {
+		return nil
+	}
+
+	var chains []Chain
+	visiting := map[string]bool{g.Root: true}
+	var path Chain
+
+	var visit func(node string)
+	visit = func(node string) {
+		for _, req := range g.Edges[node] {
+			next := g.Node(req.Dependency.Name)
+			if next == target {
+				chain := make(Chain, len(path)+1)
+				copy(chain, path)
+				chain[len(path)] = req
+				chains = append(chains, chain)
+				continue
+			}
+			if visiting[next] {
+				continue
+			}
+			visiting[next] = true
+			path = append(path, req)
+			visit(next)
+			path = path[:len(path)-1]
+			delete(visiting, next)
+		}
+	}
+	visit(g.Root)
+	return chains
+}
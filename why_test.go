@@ -0,0 +1,53 @@
+package pack
+
+import (
+	. "testing"
+)
+
+func TestGraph_Why(t *T) {
+	t.Parallel()
+
+	source := testSource{
+		"a": {"1.0.0": {"c >=1.0.0", "b"}},
+		"b": {"1.0.0": {"c ~1.2.0", "a"}},
+		"c": {"1.2.0": nil},
+		"t": {"1.0.0": {"c"}},
+	}
+	root := testRoot(t, "a ~1.0.0", "b")
+	root.Environments = map[string][]*Dependency{"test": {{Name: "t"}}}
+	r, err := Resolve(root, "test", source.source(t))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	g := NewGraph(r)
+
+	chains := g.Why("c")
+	var exp = []string{
+		"app -> a ~1.0.0 -> c >=1.0.0",
+		"app -> a ~1.0.0 -> b -> c ~1.2.0",
+		"app -> b -> c ~1.2.0",
+		"app -> b -> a -> c >=1.0.0",
+		"app -> t (test) -> c",
+	}
+	if len(chains) != len(exp) {
+		t.Fatal("Unexpected chains:", chains)
+	}
+	for i, e := range exp {
+		if got := chains[i].String(); got != e {
+			t.Errorf("%d) expected: %q, got: %q", i, e, got)
+		}
+	}
+	if env := chains[4].Environment(); env != "test" {
+		t.Error("Expected the last chain to be from test, got:", env)
+	}
+	if env := chains[0].Environment(); env != "" {
+		t.Error("Expected the first chain to be from the defaults, got:", env)
+	}
+
+	if chains = g.Why("missing"); len(chains) != 0 {
+		t.Error("Expected no chains, got:", chains)
+	}
+	if chains = g.Why("app"); len(chains) != 0 {
+		t.Error("Expected no chains to the root, got:", chains)
+	}
+}